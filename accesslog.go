@@ -0,0 +1,159 @@
+package modproxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log formats.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// defaultRuleName names the literal pattern and replacement values when logging the rule a module matched.
+const defaultRuleName = "default"
+
+// validateLogFormat checks a log format against the supported values. An empty value is allowed.
+func validateLogFormat(format string) error {
+	switch format {
+	case "", LogFormatText, LogFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("unsupported log format %q", format)
+	}
+}
+
+// NewLogger creates a logger writing to w in the configured log format, text unless set to json.
+func (cfg *Config) NewLogger(w io.Writer) *slog.Logger {
+	if cfg.LogFormat == LogFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, nil))
+	}
+	return slog.New(slog.NewTextHandler(w, nil))
+}
+
+// matchedRule names the rule a request URL resolves with: the module of the matching rule, the pattern of the
+// matching rewrite rule in regexp rewrite mode, or else defaultRuleName for the pattern and replacement values.
+func (cfg *Config) matchedRule(requestURL *url.URL) string {
+	if rule := cfg.MatchRule(requestURL.Host + requestURL.Path); rule != nil {
+		return rule.Module
+	}
+	if cfg.RewriteMode == RewriteModeRegexp {
+		root, _, rest := splitModulePath(requestURL.Path, 0, false)
+		if rule, _, err := matchRewriteRule(requestURL.Host+root+rest, cfg); err == nil {
+			return rule.Match
+		}
+		return ""
+	}
+	return defaultRuleName
+}
+
+// resolution holds how ModProxy resolved a request, for the access log and metrics.
+type resolution struct {
+	importPrefix string
+	repoURL      string
+	rule         string
+	// known reports whether the module is listed in Modules or mapped by a rule.
+	known bool
+}
+
+// resolutionKey is the context key of the resolution of a request.
+type resolutionKey struct{}
+
+// recordResolution records how a request was resolved, if the request is logged or measured.
+func recordResolution(ctx context.Context, importPrefix, repoURL, rule string, known bool) {
+	if res, ok := ctx.Value(resolutionKey{}).(*resolution); ok {
+		*res = resolution{importPrefix: importPrefix, repoURL: repoURL, rule: rule, known: known}
+	}
+}
+
+// withResolution returns a request whose context the resolution of the request is recorded in,
+// along with that resolution. A resolution already recorded in by an outer handler is shared.
+func withResolution(r *http.Request) (*http.Request, *resolution) {
+	if res, ok := r.Context().Value(resolutionKey{}).(*resolution); ok {
+		return r, res
+	}
+	res := &resolution{}
+	return r.WithContext(context.WithValue(r.Context(), resolutionKey{}, res)), res
+}
+
+// statusRecorder records the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// statusCode returns the recorded status code, 200 OK if the handler wrote nothing.
+func (rec *statusRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// Unwrap returns the underlying ResponseWriter, so http.ResponseController can flush streamed responses.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// NewAccessLogHandler wraps a handler so that every request is logged with its host, path, whether it was
+// a go-get request, the status and latency of the response, and, for requests resolved by ModProxy, the import
+// prefix, rewritten repository URL and matched rule. Traced requests are logged with their trace ID.
+// Responses with a 5xx status are logged as errors.
+func NewAccessLogHandler(logger *slog.Logger, urlGetter RequestURLGetter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, res := withResolution(r)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.statusCode()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		host := r.Host
+		if requestURL, err := url.Parse(urlGetter.GetRequestURL(r)); err == nil {
+			host = requestURL.Host
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("host", host),
+			slog.String("path", r.URL.Path),
+			slog.Bool("go_get", r.URL.Query().Get("go-get") == "1"),
+			slog.String("import_prefix", res.importPrefix),
+			slog.String("repo_url", res.repoURL),
+			slog.String("rule", res.rule),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+		}
+		// Correlate the entry with the trace of the request, if traced.
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", spanContext.TraceID().String()))
+		}
+		logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
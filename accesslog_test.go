@@ -0,0 +1,130 @@
+package modproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type AccessLogTestCase struct {
+	name     string
+	target   string
+	expected map[string]any
+}
+
+var accessLogTestCases = []AccessLogTestCase{
+	{
+		name:   "go-get request",
+		target: "https://go.loafoe.dev/modproxy/cmd?go-get=1",
+		expected: map[string]any{
+			"level":         "INFO",
+			"msg":           "request",
+			"host":          "go.loafoe.dev",
+			"path":          "/modproxy/cmd",
+			"go_get":        true,
+			"import_prefix": "go.loafoe.dev/modproxy",
+			"repo_url":      "https://github.com/loafoe-dev/go-modproxy",
+			"rule":          defaultRuleName,
+			"status":        float64(http.StatusOK),
+		},
+	},
+	{
+		name:   "Browser request for a module with a rule",
+		target: "https://go.loafoe.dev/legacy",
+		expected: map[string]any{
+			"host":          "go.loafoe.dev",
+			"path":          "/legacy",
+			"go_get":        false,
+			"import_prefix": "go.loafoe.dev/legacy",
+			"repo_url":      "https://hg.example.org/legacy",
+			"rule":          "go.loafoe.dev/legacy",
+			"status":        float64(http.StatusOK),
+		},
+	},
+	{
+		name:   "Reserved path",
+		target: "https://go.loafoe.dev/favicon.ico",
+		expected: map[string]any{
+			"path":          "/favicon.ico",
+			"import_prefix": "",
+			"repo_url":      "",
+			"rule":          "",
+			"status":        float64(http.StatusNotFound),
+		},
+	},
+}
+
+func TestAccessLogHandler(t *testing.T) {
+	cfg := &Config{
+		HostPattern:     "go.loafoe.dev",
+		HostReplacement: "github.com",
+		PathPattern:     "/",
+		PathReplacement: "/loafoe-dev/go-",
+		PathDepth:       1,
+		LogFormat:       LogFormatJSON,
+		Rules:           []Rule{{Module: "go.loafoe.dev/legacy", Repository: "https://hg.example.org/legacy", VCS: "hg"}},
+	}
+
+	for _, tc := range accessLogTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			urlGetter := DefaultRequestURLGetter{}
+			handler := NewAccessLogHandler(cfg.NewLogger(&buf), urlGetter,
+				NewModProxyHandler(cfg, urlGetter, DefaultPackagePathGetter{}, DefaultURLRewriter{}))
+
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("access log %q is not a JSON object: %v", buf.String(), err)
+			}
+			for key, want := range tc.expected {
+				if got := entry[key]; got != want {
+					t.Errorf("access log %s = %v, want %v", key, got, want)
+				}
+			}
+			if _, ok := entry["latency"]; !ok {
+				t.Errorf("access log lacks latency")
+			}
+		})
+	}
+}
+
+func TestAccessLogHandlerServerError(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := &Config{}
+	handler := NewAccessLogHandler(cfg.NewLogger(&buf), DefaultRequestURLGetter{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/modproxy", nil))
+
+	line := buf.String()
+	if !strings.Contains(line, "level=ERROR") || !strings.Contains(line, "status=500") {
+		t.Errorf("access log = %q, want text entry at level ERROR with status 500", line)
+	}
+}
+
+func TestMatchedRule(t *testing.T) {
+	cfg := &Config{
+		RewriteMode:  RewriteModeRegexp,
+		Rules:        []Rule{{Module: "go.loafoe.dev/legacy", Repository: "https://hg.example.org/legacy"}},
+		RewriteRules: []RewriteRule{{Match: `^go\.loafoe\.dev/x/([^/]+)`, Replace: "https://gitlab.com/loafoe/${1}-go"}},
+	}
+
+	tests := map[string]string{
+		"https://go.loafoe.dev/legacy/sub": "go.loafoe.dev/legacy",
+		"https://go.loafoe.dev/x/tool/v2":  `^go\.loafoe\.dev/x/([^/]+)`,
+		"https://go.loafoe.dev/unknown":    "",
+	}
+	for target, want := range tests {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if got := cfg.matchedRule(req.URL); got != want {
+			t.Errorf("matchedRule(%s) = %q, want %q", target, got, want)
+		}
+	}
+}
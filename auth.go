@@ -0,0 +1,177 @@
+package modproxy
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Module visibilities.
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+// parseHtpasswd parses an htpasswd file into a map of user names to password hashes.
+// Only bcrypt and {SHA} hashes are supported.
+func parseHtpasswd(data string) (map[string]string, error) {
+	users := make(map[string]string)
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, found := strings.Cut(line, ":")
+		if !found || user == "" {
+			return nil, fmt.Errorf("line %d: expected user:hash", i+1)
+		}
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "{SHA}") {
+			return nil, fmt.Errorf("line %d: unsupported hash for user %q, use bcrypt or {SHA}", i+1, user)
+		}
+		users[user] = hash
+	}
+	return users, nil
+}
+
+// checkHtpasswd reports whether password matches an htpasswd hash.
+func checkHtpasswd(hash, password string) bool {
+	if sha, found := strings.CutPrefix(hash, "{SHA}"); found {
+		sum := sha1.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(sha), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// LoadAuthFile reads the users of the htpasswd file named by AuthFile, if set.
+func (cfg *Config) LoadAuthFile() error {
+	if cfg.AuthFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(cfg.AuthFile)
+	if err != nil {
+		return err
+	}
+	users, err := parseHtpasswd(string(data))
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", cfg.AuthFile, err)
+	}
+	cfg.users = users
+	return nil
+}
+
+// AuthEnabled reports whether clients have to authenticate for private modules.
+func (cfg *Config) AuthEnabled() bool {
+	return cfg.AuthFile != "" || len(cfg.AuthTokens) > 0
+}
+
+// isValidToken reports whether token is one of the configured bearer tokens.
+func (cfg *Config) isValidToken(token string) bool {
+	valid := false
+	for _, t := range cfg.AuthTokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// authenticate reports whether a request carries a configured bearer token, or basic auth credentials of a user
+// of the htpasswd file. As the go command and git only send basic auth, a token is also accepted as basic auth
+// password with any user name.
+func (cfg *Config) authenticate(r *http.Request) bool {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return cfg.isValidToken(token)
+	}
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	if cfg.isValidToken(password) {
+		return true
+	}
+	hash, ok := cfg.users[user]
+	return ok && checkHtpasswd(hash, password)
+}
+
+// GetVisibility returns the visibility of a package path: that of the matching rule, else the configured one,
+// else private.
+func (cfg *Config) GetVisibility(packagePath string) string {
+	if rule := cfg.MatchRule(packagePath); rule != nil && rule.Visibility != "" {
+		return rule.Visibility
+	}
+	if cfg.Visibility == "" {
+		return VisibilityPrivate
+	}
+	return cfg.Visibility
+}
+
+// validateVisibility checks a visibility against the supported values. An empty value is allowed.
+func validateVisibility(visibility string) error {
+	switch visibility {
+	case "", VisibilityPublic, VisibilityPrivate:
+		return nil
+	default:
+		return fmt.Errorf("unsupported visibility %q", visibility)
+	}
+}
+
+// requestImportPath returns the import path a request refers to: the module of a GOPROXY protocol request,
+// the repository of a GitProxy request, or else the requested host and path.
+func requestImportPath(requestURL *url.URL) string {
+	if importPath, _, ok := parseGitProxyPath(requestURL.Path); ok {
+		return importPath
+	}
+	if IsModuleProxyPath(requestURL.Path) {
+		if modulePath, _, err := parseModuleProxyPath(requestURL.Path); err == nil {
+			return modulePath
+		}
+	}
+	return requestURL.Host + strings.TrimSuffix(requestURL.Path, "/")
+}
+
+// NewAuthHandler wraps a handler so that requests for private modules require authentication with the
+// configured htpasswd users or bearer tokens, while public modules stay anonymous. Requests for modules
+// of unknown hosts, such as those forwarded to an upstream proxy, use the top-level visibility.
+// Without any users or tokens configured, the handler is returned as is.
+func NewAuthHandler(cfg *Config, urlGetter RequestURLGetter, next http.Handler) http.Handler {
+	if !cfg.AuthEnabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// robots.txt and the like never reveal anything about modules.
+		if r.URL.Path == "/robots.txt" || notFoundPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestURL, err := url.Parse(urlGetter.GetRequestURL(r))
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		importPath := requestImportPath(requestURL)
+		host, _, _ := strings.Cut(importPath, "/")
+		hostCfg, ok := cfg.ForHost(host)
+		if !ok {
+			hostCfg = cfg
+		}
+
+		if hostCfg.GetVisibility(importPath) != VisibilityPublic && !cfg.authenticate(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="modproxy"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
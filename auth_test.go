@@ -0,0 +1,164 @@
+package modproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Test case struct
+type AuthTestCase struct {
+	name         string
+	path         string
+	user         string // Optional basic auth user
+	password     string // Optional basic auth password
+	bearer       string // Optional bearer token
+	expectedCode int
+}
+
+// Test cases
+var authTestCases = []AuthTestCase{
+	{
+		name:         "Public module without credentials",
+		path:         "/oss?go-get=1",
+		expectedCode: http.StatusOK,
+	},
+	{
+		name:         "Subpackage of public module without credentials",
+		path:         "/oss/cmd?go-get=1",
+		expectedCode: http.StatusOK,
+	},
+	{
+		name:         "Private module without credentials",
+		path:         "/internal?go-get=1",
+		expectedCode: http.StatusUnauthorized,
+	},
+	{
+		name:         "Private module with htpasswd user",
+		path:         "/internal?go-get=1",
+		user:         "alice",
+		password:     "wonderland",
+		expectedCode: http.StatusOK,
+	},
+	{
+		name:         "Private module with {SHA} htpasswd user",
+		path:         "/internal?go-get=1",
+		user:         "bob",
+		password:     "builder",
+		expectedCode: http.StatusOK,
+	},
+	{
+		name:         "Private module with wrong password",
+		path:         "/internal?go-get=1",
+		user:         "alice",
+		password:     "looking-glass",
+		expectedCode: http.StatusUnauthorized,
+	},
+	{
+		name:         "Private module with bearer token",
+		path:         "/internal?go-get=1",
+		bearer:       "ci-token",
+		expectedCode: http.StatusOK,
+	},
+	{
+		name:         "Private module with invalid bearer token",
+		path:         "/internal?go-get=1",
+		bearer:       "expired-token",
+		expectedCode: http.StatusUnauthorized,
+	},
+	{
+		name:         "Private module with token as basic auth password",
+		path:         "/internal?go-get=1",
+		user:         "ci",
+		password:     "ci-token",
+		expectedCode: http.StatusOK,
+	},
+	{
+		name:         "GOPROXY request for private module without credentials",
+		path:         "/go.loafoe.dev/internal/@v/list",
+		expectedCode: http.StatusUnauthorized,
+	},
+	{
+		name:         "robots.txt without credentials",
+		path:         "/robots.txt",
+		expectedCode: http.StatusOK,
+	},
+	{
+		name:         "Root path without credentials",
+		path:         "/",
+		expectedCode: http.StatusUnauthorized,
+	},
+	{
+		name:         "GitProxy request for public module without credentials",
+		path:         "/.modproxy/git/go.loafoe.dev/oss/info/refs?service=git-receive-pack",
+		expectedCode: http.StatusForbidden,
+	},
+}
+
+func TestNewAuthHandler(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("wonderland"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeFile(t, dir, "htpasswd", "# users\nalice:"+string(hash)+"\nbob:{SHA}9SMYoF5RilWWASry7TjeaKwmpGg=\n")
+
+	cfg := &Config{
+		HostPattern:     "go.loafoe.dev",
+		HostReplacement: "github.com",
+		PathPattern:     "/",
+		PathReplacement: "/loafoe-dev/go-",
+		PathDepth:       1,
+		AuthFile:        filepath.Join(dir, "htpasswd"),
+		AuthTokens:      []string{"ci-token"},
+		Visibility:      VisibilityPrivate,
+		Rules:           []Rule{{Module: "go.loafoe.dev/oss", Repository: "https://github.com/loafoe-dev/go-oss", Visibility: VisibilityPublic}},
+	}
+	if err := cfg.LoadAuthFile(); err != nil {
+		t.Fatalf("LoadAuthFile() error = %v", err)
+	}
+	handler := NewHandler(cfg)
+
+	for _, tc := range authTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev"+tc.path, nil)
+			if tc.user != "" {
+				req.SetBasicAuth(tc.user, tc.password)
+			}
+			if tc.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.bearer)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedCode {
+				t.Errorf("NewAuthHandler() got code %v, want %v", w.Code, tc.expectedCode)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("NewAuthHandler() did not send a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestNewAuthHandlerDisabled(t *testing.T) {
+	next := http.NotFoundHandler()
+	req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/internal", nil)
+	w := httptest.NewRecorder()
+	NewAuthHandler(&Config{Visibility: VisibilityPrivate}, DefaultRequestURLGetter{}, next).ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("NewAuthHandler() without users or tokens got code %v, want %v", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestParseHtpasswd(t *testing.T) {
+	if _, err := parseHtpasswd("alice:$apr1$salt$hash\n"); err == nil {
+		t.Errorf("parseHtpasswd() accepted an unsupported hash")
+	}
+	if _, err := parseHtpasswd("alice\n"); err == nil {
+		t.Errorf("parseHtpasswd() accepted a line without hash")
+	}
+}
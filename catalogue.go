@@ -0,0 +1,197 @@
+package modproxy
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// tagLookupTimeout bounds the time spent looking up the tags of repositories, so a slow origin
+// doesn't hold up the index and module pages.
+const tagLookupTimeout = 5 * time.Second
+
+// CatalogueEntry describes a module listed on the index page and shown on its module page.
+type CatalogueEntry struct {
+	ImportPath  string `json:"importPath"`
+	Description string `json:"description,omitempty"`
+	// Repository is the repository URL shown on the pages. Defaults to the rewritten repository URL.
+	Repository string `json:"repository,omitempty"`
+	// Readme is an excerpt of the README shown on the module page.
+	Readme string `json:"readme,omitempty"`
+}
+
+// indexModule is a module listed on the index page.
+type indexModule struct {
+	ImportPath  string
+	Description string
+	Repository  string
+	Version     string // Latest version, empty if unknown.
+}
+
+// indexPage is the data the index template is rendered with.
+type indexPage struct {
+	Host    string
+	Modules []indexModule
+}
+
+// maxCachedTags bounds the number of repositories whose tags are cached.
+const maxCachedTags = 1000
+
+// cachedTags are the tags of a remote repository as looked up at a point in time.
+type cachedTags struct {
+	tags    []string
+	err     error
+	fetched time.Time
+}
+
+// tagLookup is a lookup of the tags of a remote repository in progress, done once done is closed.
+type tagLookup struct {
+	done chan struct{}
+	tags []string
+	err  error
+}
+
+// tagCache caches the tags of remote repositories for DefaultRefreshInterval. Concurrent requests for the
+// tags of the same repository share a single lookup.
+type tagCache struct {
+	// lookup returns the tags of the repository at a URL.
+	lookup func(ctx context.Context, repoURL string) ([]string, error)
+
+	mu       sync.Mutex
+	entries  map[string]cachedTags
+	inflight map[string]*tagLookup
+}
+
+// newTagCache creates a tagCache looking up tags with lookup.
+func newTagCache(lookup func(ctx context.Context, repoURL string) ([]string, error)) *tagCache {
+	return &tagCache{
+		lookup:   lookup,
+		entries:  make(map[string]cachedTags),
+		inflight: make(map[string]*tagLookup),
+	}
+}
+
+// remoteTags caches the tags of the repositories shown on the index and module pages.
+var remoteTags = newTagCache(lsRemoteTags)
+
+// tags returns the tags of the git repository at repoURL. Failed lookups are cached as well,
+// so an unreachable origin isn't asked again for every page view.
+func (c *tagCache) tags(ctx context.Context, repoURL string) ([]string, error) {
+	c.mu.Lock()
+	if cached, ok := c.entries[repoURL]; ok && time.Since(cached.fetched) < DefaultRefreshInterval {
+		c.mu.Unlock()
+		return cached.tags, cached.err
+	}
+	call, ok := c.inflight[repoURL]
+	if !ok {
+		call = &tagLookup{done: make(chan struct{})}
+		c.inflight[repoURL] = call
+		// The lookup outlives a request that gives up waiting, so the other requests still get its result.
+		go c.fetch(context.WithoutCancel(ctx), repoURL, call)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.tags, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch looks up the tags of the repository at repoURL for call and caches them.
+func (c *tagCache) fetch(ctx context.Context, repoURL string, call *tagLookup) {
+	ctx, cancel := context.WithTimeout(ctx, tagLookupTimeout)
+	defer cancel()
+	call.tags, call.err = c.lookup(ctx, repoURL)
+
+	c.mu.Lock()
+	delete(c.inflight, repoURL)
+	if _, ok := c.entries[repoURL]; !ok && len(c.entries) >= maxCachedTags {
+		c.evict()
+	}
+	c.entries[repoURL] = cachedTags{tags: call.tags, err: call.err, fetched: time.Now()}
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// evict removes the expired entries, or else an arbitrary one if none has expired. The caller must hold c.mu.
+func (c *tagCache) evict() {
+	for repoURL, cached := range c.entries {
+		if time.Since(cached.fetched) >= DefaultRefreshInterval {
+			delete(c.entries, repoURL)
+		}
+	}
+	for repoURL := range c.entries {
+		if len(c.entries) < maxCachedTags {
+			break
+		}
+		delete(c.entries, repoURL)
+	}
+}
+
+// latest returns the latest tagged version of the module at modulePath in the git repository at repoURL,
+// whose module root is packagePath. Returns an empty string if the version cannot be determined.
+func (c *tagCache) latest(ctx context.Context, modulePath, packagePath, repoURL string) string {
+	dir, pathMajor, err := moduleDirectory(modulePath, packagePath)
+	if err != nil {
+		return ""
+	}
+	tags, err := c.tags(ctx, repoURL)
+	if err != nil {
+		return ""
+	}
+	return latestVersion(moduleVersions(tags, tagPrefix(dir), pathMajor))
+}
+
+// catalogueModules resolves the repositories and latest versions of the modules in the catalogue,
+// resolving their import paths as if requested with the given scheme. Private modules are left out
+// unless showPrivate is set.
+func catalogueModules(ctx context.Context, cfg *Config, pathGetter PackagePathGetter, urlRewriter URLRewriter, scheme string, showPrivate bool) []indexModule {
+	ctx, cancel := context.WithTimeout(ctx, tagLookupTimeout)
+	defer cancel()
+
+	var entries []CatalogueEntry
+	for _, entry := range cfg.Catalogue {
+		if showPrivate || cfg.GetVisibility(entry.ImportPath) == VisibilityPublic {
+			entries = append(entries, entry)
+		}
+	}
+
+	modules := make([]indexModule, len(entries))
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		modules[i] = indexModule{
+			ImportPath:  entry.ImportPath,
+			Description: entry.Description,
+			Repository:  entry.Repository,
+		}
+
+		wg.Add(1)
+		go func(m *indexModule) {
+			defer wg.Done()
+
+			if m.Repository == "" {
+				if repoURL, err := urlRewriter.RewriteURL(scheme+"://"+m.ImportPath, cfg); err == nil {
+					m.Repository = repoURL
+				}
+			}
+			if _, packagePath, repoURL, err := resolveGitRepository(cfg, pathGetter, urlRewriter, scheme, m.ImportPath); err == nil {
+				m.Version = remoteTags.latest(ctx, m.ImportPath, packagePath, repoURL)
+			}
+		}(&modules[i])
+	}
+	wg.Wait()
+	return modules
+}
+
+// serveIndex renders the index page listing the modules in the catalogue of the requested host,
+// including private ones only if showPrivate is set.
+func serveIndex(w http.ResponseWriter, r *http.Request, cfg *Config, requestURL *url.URL, pathGetter PackagePathGetter, urlRewriter URLRewriter, showPrivate bool) {
+	renderTemplate(w, cfg, indexTemplate, indexPage{
+		Host:    requestURL.Host,
+		Modules: catalogueModules(r.Context(), cfg, pathGetter, urlRewriter, requestURL.Scheme, showPrivate),
+	})
+}
@@ -0,0 +1,237 @@
+package modproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// The index and module pages only look up the tags of local repositories in tests, never those of origins
+	// on the network.
+	remoteTags = newTagCache(func(ctx context.Context, repoURL string) ([]string, error) {
+		if !strings.HasPrefix(repoURL, "file://") {
+			return nil, errors.New("looking up the tags of remote repositories is disabled in tests")
+		}
+		return lsRemoteTags(ctx, repoURL)
+	})
+	os.Exit(m.Run())
+}
+
+// countTagLookups replaces the tag lookup for the duration of a test with one answering tags, and returns
+// the number of lookups made.
+func countTagLookups(t *testing.T, tags []string) *atomic.Int32 {
+	var lookups atomic.Int32
+	saved := remoteTags
+	remoteTags = newTagCache(func(ctx context.Context, repoURL string) ([]string, error) {
+		lookups.Add(1)
+		return tags, nil
+	})
+	t.Cleanup(func() { remoteTags = saved })
+	return &lookups
+}
+
+func TestServeIndex(t *testing.T) {
+	dir := newTestRepository(t)
+	cfg := &Config{
+		HostPattern:     "go.loafoe.dev",
+		HostReplacement: "github.com",
+		PathPattern:     "/",
+		PathReplacement: "/loafoe-dev/go-",
+		PathDepth:       1,
+		Rules: []Rule{
+			{Module: "go.loafoe.dev/fixture", Repository: "file://" + dir},
+			// A repository that doesn't exist, listed without a version.
+			{Module: "go.loafoe.dev/bitfield", Repository: "file://" + filepath.Join(t.TempDir(), "bitfield")},
+		},
+		Catalogue: []CatalogueEntry{
+			{ImportPath: "go.loafoe.dev/fixture", Description: "Test <fixture>"},
+			{ImportPath: "go.loafoe.dev/fixture/v2", Description: "Next major version"},
+			{ImportPath: "go.loafoe.dev/bitfield", Repository: "https://example.org/bitfield"},
+		},
+	}
+	handler := NewModProxyHandler(cfg, DefaultRequestURLGetter{}, DefaultPackagePathGetter{}, DefaultURLRewriter{})
+
+	req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("ModProxy(/) got code %v, want %v", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`<a href="https://pkg.go.dev/go.loafoe.dev/fixture"><code>go.loafoe.dev/fixture</code></a>`,
+		"Test &lt;fixture&gt;",
+		"<td>v1.0.1</td>",
+		"<td>v2.0.0</td>",
+		"file://" + dir + "</a>",
+		`<a href="https://example.org/bitfield">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("ModProxy(/) got body %q, want body containing %q", body, want)
+		}
+	}
+	if got := strings.Count(body, "<td>v"); got != 2 {
+		t.Errorf("ModProxy(/) got %d versions, want 2", got)
+	}
+}
+
+func TestServeIndexPrivateModules(t *testing.T) {
+	cfg := &Config{
+		HostPattern:     "go.loafoe.dev",
+		HostReplacement: "github.com",
+		PathPattern:     "/",
+		PathReplacement: "/loafoe-dev/go-",
+		PathDepth:       1,
+		AuthTokens:      []string{"secret"},
+		Visibility:      VisibilityPublic,
+		Rules:           []Rule{{Module: "go.loafoe.dev/secret", Repository: "https://example.org/internal/secret", Visibility: VisibilityPrivate}},
+		Catalogue: []CatalogueEntry{
+			{ImportPath: "go.loafoe.dev/modproxy"},
+			{ImportPath: "go.loafoe.dev/secret"},
+		},
+	}
+	handler := NewHandler(cfg)
+
+	for _, tc := range []struct {
+		name        string
+		token       string
+		showPrivate bool
+	}{
+		{"Anonymous", "", false},
+		{"Authenticated", "secret", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/", nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("ModProxy(/) got code %v, want %v", w.Code, http.StatusOK)
+			}
+			body := w.Body.String()
+			if !strings.Contains(body, "go.loafoe.dev/modproxy") {
+				t.Errorf("ModProxy(/) got body %q, want the public module listed", body)
+			}
+			for _, private := range []string{"go.loafoe.dev/secret", "example.org/internal/secret"} {
+				if strings.Contains(body, private) != tc.showPrivate {
+					t.Errorf("ModProxy(/) got body %q, want %q listed: %v", body, private, tc.showPrivate)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "index.html", `<h1>Modules of {{.Host}}</h1>{{range .Modules}}<p>{{.ImportPath}}</p>{{end}}`)
+
+	cfg := &Config{
+		HostPattern: "go.loafoe.dev",
+		PathDepth:   1,
+		TemplateDir: dir,
+		Catalogue:   []CatalogueEntry{{ImportPath: "go.loafoe.dev/modproxy", Repository: "https://github.com/epiccoolguy/go-modproxy"}},
+	}
+	if err := cfg.LoadTemplates(); err != nil {
+		t.Fatalf("LoadTemplates() error = %v", err)
+	}
+	handler := NewModProxyHandler(cfg, DefaultRequestURLGetter{}, DefaultPackagePathGetter{}, DefaultURLRewriter{})
+
+	req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if want := "<h1>Modules of go.loafoe.dev</h1><p>go.loafoe.dev/modproxy</p>"; w.Body.String() != want {
+		t.Errorf("ModProxy(/) got body %q, want %q", w.Body.String(), want)
+	}
+}
+
+func TestLoadTemplatesEmptyDir(t *testing.T) {
+	cfg := &Config{TemplateDir: t.TempDir()}
+	if err := cfg.LoadTemplates(); err == nil {
+		t.Errorf("LoadTemplates() without templates did not return an error")
+	}
+}
+
+func TestTagCacheSharesLookups(t *testing.T) {
+	release := make(chan struct{})
+	var lookups atomic.Int32
+	cache := newTagCache(func(ctx context.Context, repoURL string) ([]string, error) {
+		lookups.Add(1)
+		<-release
+		return []string{"v1.0.0"}, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tags, err := cache.tags(context.Background(), "https://example.org/repo"); err != nil || len(tags) != 1 {
+				t.Errorf("tags() = %v, %v, want [v1.0.0]", tags, err)
+			}
+		}()
+	}
+	// Wait for the lookup to be in flight before releasing it.
+	for lookups.Load() == 0 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+
+	if _, err := cache.tags(context.Background(), "https://example.org/repo"); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookups.Load(); got != 1 {
+		t.Errorf("tags() looked up %d times, want 1", got)
+	}
+}
+
+func TestTagCacheBound(t *testing.T) {
+	cache := newTagCache(func(ctx context.Context, repoURL string) ([]string, error) {
+		return nil, nil
+	})
+	for i := 0; i < maxCachedTags+10; i++ {
+		if _, err := cache.tags(context.Background(), fmt.Sprintf("https://example.org/repo-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(cache.entries) > maxCachedTags {
+		t.Errorf("tagCache holds %d entries, want at most %d", len(cache.entries), maxCachedTags)
+	}
+}
+
+func TestModulePageLooksUpKnownModulesOnly(t *testing.T) {
+	lookups := countTagLookups(t, []string{"v1.0.0"})
+	cfg := &Config{
+		HostPattern:     "go.loafoe.dev",
+		HostReplacement: "github.com",
+		PathPattern:     "/",
+		PathReplacement: "/loafoe-dev/go-",
+		PathDepth:       1,
+		Modules:         []string{"go.loafoe.dev/modproxy"},
+	}
+	handler := NewModProxyHandler(cfg, DefaultRequestURLGetter{}, DefaultPackagePathGetter{}, DefaultURLRewriter{})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/anything", nil))
+	if got := lookups.Load(); got != 0 {
+		t.Errorf("ModProxy looked up the tags of an unknown module %d times", got)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/modproxy", nil))
+	if got := lookups.Load(); got != 1 {
+		t.Errorf("ModProxy looked up the tags of a known module %d times, want 1", got)
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"os"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
-	// Blank-import the function package so the init() runs
-	_ "go.loafoe.dev/modproxy"
+	// Blank-import the function package so the init() registers ModProxy
+	_ "go.loafoe.dev/modproxy/gcf"
 )
 
 func main() {
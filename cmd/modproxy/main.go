@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.loafoe.dev/modproxy"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "mirror" {
+		mirror(os.Args[2:])
+		return
+	}
+
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to the JSON configuration file")
+	flag.Parse()
+
+	// Use PORT environment variable, or default to 8080.
+	port := "8080"
+	if envPort := os.Getenv("PORT"); envPort != "" {
+		port = envPort
+	}
+
+	// By default, listen on all interfaces. If testing locally, run with
+	// LOCAL_ONLY=true to avoid triggering firewall warnings and
+	// exposing the server outside of your own machine.
+	hostname := ""
+	if localOnly := os.Getenv("LOCAL_ONLY"); localOnly == "true" {
+		hostname = "127.0.0.1"
+	}
+
+	cfg, err := modproxy.LoadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	// Shut down gracefully on SIGINT and SIGTERM, the latter being sent by Cloud Run and Kubernetes.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := modproxy.SetupTracing(ctx, cfg)
+	if err != nil {
+		log.Fatalf("modproxy.SetupTracing: %v", err)
+	}
+
+	srv := modproxy.NewServer(net.JoinHostPort(hostname, port), modproxy.NewHandler(cfg))
+	err = modproxy.Serve(ctx, srv)
+
+	// Flush the spans of the last requests.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), modproxy.DefaultShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("shutting down tracing: %v", err)
+	}
+
+	if err != nil {
+		log.Fatalf("modproxy.Serve: %v\n", err)
+	}
+}
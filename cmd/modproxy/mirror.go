@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.loafoe.dev/modproxy"
+)
+
+// mirror implements the mirror command, which writes every version of the modules known to the
+// configuration to a directory usable as GOPROXY=file:///path.
+func mirror(args []string) {
+	flags := flag.NewFlagSet("mirror", flag.ExitOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path to the JSON configuration file")
+	dir := flags.String("dir", "", "directory to write the modules to")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: modproxy mirror -dir <directory> [-config <file>]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *dir == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := modproxy.LoadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := modproxy.NewModuleServer(cfg, modproxy.DefaultRequestURLGetter{}, modproxy.DefaultPackagePathGetter{}, modproxy.DefaultURLRewriter{})
+	added, err := server.Mirror(ctx, *dir)
+	for _, v := range added {
+		log.Printf("mirrored %s", v)
+	}
+	if err != nil {
+		log.Fatalf("modproxy mirror: %v", err)
+	}
+	log.Printf("mirrored %d new versions to %s", len(added), *dir)
+}
@@ -1,17 +1,147 @@
 package modproxy
 
-import "os"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
 
 // Config holds the configuration for ModProxy.
 type Config struct {
-	SchemePattern     string
-	SchemeReplacement string
-	HostPattern       string
-	HostReplacement   string
-	PathPattern       string
-	PathReplacement   string
+	SchemePattern     string `json:"schemePattern,omitempty"`
+	SchemeReplacement string `json:"schemeReplacement,omitempty"`
+	HostPattern       string `json:"hostPattern,omitempty"`
+	HostReplacement   string `json:"hostReplacement,omitempty"`
+	PathPattern       string `json:"pathPattern,omitempty"`
+	PathReplacement   string `json:"pathReplacement,omitempty"`
+	// PathDepth is the number of path elements that make up the module root.
+	// Any further elements are treated as subpackages of that module. A depth of 0 uses the full path.
+	// Modules listed in Modules determine their own module root, whatever their depth.
+	PathDepth int `json:"pathDepth,omitempty"`
+	// VersionedPrefix keeps /vN major version suffixes in the go-import prefix, for major version subdirectory
+	// modules. The repository URL never includes the suffix.
+	VersionedPrefix bool `json:"versionedPrefix,omitempty"`
+	// GopkgVersions recognises gopkg.in-style .vN major version suffixes, e.g. go.loafoe.dev/yaml.v3.
+	GopkgVersions bool `json:"gopkgVersions,omitempty"`
+	// SourceForge selects the go-source templates (github, gitlab, gitea or bitbucket). Empty disables the go-source tag.
+	SourceForge string `json:"sourceForge,omitempty"`
+	// SourceRef is the branch or tag the go-source directory and file links point at.
+	SourceRef string `json:"sourceRef,omitempty"`
+	// VCS is the version control system advertised in the go-import meta tag.
+	VCS string `json:"vcs,omitempty"`
+	// Rules explicitly map modules to their repositories. Modules without a matching rule
+	// fall back to the pattern and replacement values above.
+	Rules []Rule `json:"rules,omitempty"`
+	// RewriteMode selects how modules without a matching rule are rewritten: literal pattern and replacement
+	// values, or regular expression rewrite rules.
+	RewriteMode string `json:"rewriteMode,omitempty"`
+	// RewriteRules are evaluated in order against the import path in regexp rewrite mode. The first match wins.
+	RewriteRules []RewriteRule `json:"rewriteRules,omitempty"`
+	// BrowserRedirect selects where requests without ?go-get=1 are redirected to: none, pkgsite, repository,
+	// or a custom URL template.
+	BrowserRedirect string `json:"browserRedirect,omitempty"`
+	// KnownModulesOnly makes ModProxy answer 404 Not Found for modules that are neither listed in Modules
+	// nor mapped by a rule.
+	KnownModulesOnly bool `json:"knownModulesOnly,omitempty"`
+	// Modules lists the module paths known to this proxy.
+	Modules []string `json:"modules,omitempty"`
+	// ModulesFile names a file listing further known module paths, one per line.
+	ModulesFile string `json:"modulesFile,omitempty"`
+	// Hosts holds the configuration of additional virtual hosts served by the same process, keyed by host name.
+	// If set, requests for hosts other than these and HostPattern are answered with 404 Not Found.
+	Hosts map[string]*Config `json:"hosts,omitempty"`
+	// ServeModules enables the GOPROXY protocol endpoints, serving module versions built from git checkouts
+	// of the rewritten repositories.
+	ServeModules bool `json:"serveModules,omitempty"`
+	// CacheDir is the directory holding the git checkouts used to serve modules.
+	CacheDir string `json:"cacheDir,omitempty"`
+	// Upstream is a GOPROXY-style list of proxies that GOPROXY protocol requests for modules not routed by this
+	// configuration are forwarded to, e.g. "https://proxy.golang.org". Empty disables forwarding.
+	Upstream string `json:"upstream,omitempty"`
+	// GitProxy points the go-import meta tag of git modules at GitProxy, which reverse-proxies the git smart-HTTP
+	// protocol to the rewritten repository, so only modproxy needs credentials for private repositories.
+	GitProxy bool `json:"gitProxy,omitempty"`
+	// GitCredentialsFile names a file holding the "username:password" credentials GitProxy uses for repositories
+	// of modules whose rule has no credentials file.
+	GitCredentialsFile string `json:"gitCredentialsFile,omitempty"`
+	// AuthFile names an htpasswd file of the users allowed to access private modules.
+	AuthFile string `json:"authFile,omitempty"`
+	// AuthTokens are bearer tokens allowed to access private modules.
+	AuthTokens []string `json:"authTokens,omitempty"`
+	// Visibility is the visibility of modules without a rule setting one: public modules can be accessed
+	// anonymously, private ones require authentication if AuthFile or AuthTokens is set.
+	Visibility string `json:"visibility,omitempty"`
+
+	// Catalogue lists the modules shown on the index page at the root path.
+	Catalogue []CatalogueEntry `json:"catalogue,omitempty"`
+	// TemplateDir names a directory of *.html templates replacing the built-in templates with the same name.
+	TemplateDir string `json:"templateDir,omitempty"`
+	// TrustedProxies lists the CIDR ranges or IP addresses of reverse proxies, such as a load balancer, whose
+	// Forwarded, X-Forwarded-Proto and X-Forwarded-Host headers determine the scheme and host of requests.
+	// The headers of all other clients are ignored. Only the top-level configuration is used.
+	TrustedProxies []string `json:"trustedProxies,omitempty"`
+	// LogFormat selects the format of the access log, text or json. Only the top-level configuration is used.
+	LogFormat string `json:"logFormat,omitempty"`
+	// MetricsPath is the path at which metrics are served in the Prometheus text format. It shadows a module
+	// of the same name, so use a path starting with a dot, e.g. /.modproxy/metrics, to serve such a module.
+	// Only the top-level configuration is used.
+	MetricsPath string `json:"metricsPath,omitempty"`
+	// TraceExporter selects where SetupTracing exports spans to: none, otlp or stdout.
+	// Only the top-level configuration is used.
+	TraceExporter string `json:"traceExporter,omitempty"`
+
+	// users maps the users of AuthFile to their password hashes.
+	users map[string]string
+	// templates holds the built-in templates along with those loaded from TemplateDir.
+	templates *template.Template
+}
+
+// Rule maps a module import path to the repository that serves it.
+type Rule struct {
+	Module      string `json:"module"`
+	Repository  string `json:"repository"`
+	VCS         string `json:"vcs,omitempty"`
+	SourceForge string `json:"sourceForge,omitempty"`
+	// CredentialsFile names a file holding the "username:password" credentials GitProxy uses for the repository.
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+	// Visibility is the visibility of the module, public or private.
+	Visibility string `json:"visibility,omitempty"`
+}
+
+// RewriteRule rewrites import paths matching a regular expression to a repository URL.
+// Replace may refer to capture groups of Match, e.g. "https://gitlab.com/loafoe/${1}-go".
+type RewriteRule struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+
+	// re holds Match compiled by Validate.
+	re *regexp.Regexp
+}
+
+// regexp returns the compiled pattern of the rule, compiling it if the configuration wasn't validated.
+func (rule *RewriteRule) regexp() (*regexp.Regexp, error) {
+	if rule.re != nil {
+		return rule.re, nil
+	}
+	return regexp.Compile(rule.Match)
 }
 
+// Rewrite modes.
+const (
+	RewriteModeLiteral = "literal"
+	RewriteModeRegexp  = "regexp"
+)
+
 // Constants for default pattern and replacement values.
 const (
 	DefaultSchemePattern     = "http"
@@ -20,8 +150,32 @@ const (
 	DefaultHostReplacement   = "github.com"
 	DefaultPathPattern       = "/"
 	DefaultPathReplacement   = "/loafoe-dev/go-"
+	DefaultPathDepth         = 1
+	DefaultSourceForge       = ForgeGitHub
+	DefaultSourceRef         = "main"
+	DefaultVCS               = "git"
+	DefaultRewriteMode       = RewriteModeLiteral
+	DefaultBrowserRedirect   = BrowserRedirectNone
+	DefaultVisibility        = VisibilityPrivate
+	DefaultLogFormat         = LogFormatText
+	DefaultTraceExporter     = TraceExporterNone
 )
 
+// DefaultCacheDir returns the default directory for git checkouts, below the system temporary directory.
+func DefaultCacheDir() string {
+	return filepath.Join(os.TempDir(), "modproxy")
+}
+
+// supportedVCS holds the version control systems the go command accepts in a go-import meta tag.
+var supportedVCS = map[string]bool{
+	"git":    true,
+	"hg":     true,
+	"svn":    true,
+	"bzr":    true,
+	"fossil": true,
+	"mod":    true,
+}
+
 // getEnvOrDefault retrieves an environment variable by key.
 // Returns defaultValue if the environment variable is not set.
 func getEnvOrDefault(key, defaultValue string) string {
@@ -32,14 +186,482 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return value
 }
 
+// getEnvIntOrDefault retrieves an environment variable by key and parses it as an integer.
+// Returns defaultValue if the environment variable is not set or is not a valid integer.
+func getEnvIntOrDefault(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvBoolOrDefault retrieves an environment variable by key and parses it as a boolean.
+// Returns defaultValue if the environment variable is not set or is not a valid boolean.
+func getEnvBoolOrDefault(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvList retrieves an environment variable by key and splits it into a comma-separated list.
+// Returns nil if the environment variable is not set.
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // NewConfigFromEnvironment creates a new instance of Config with values from environment variables or default values.
 func NewConfigFromEnvironment() *Config {
 	return &Config{
-		SchemePattern:     getEnvOrDefault("SCHEME_PATTERN", DefaultSchemePattern),
-		SchemeReplacement: getEnvOrDefault("SCHEME_REPLACEMENT", DefaultSchemeReplacement),
-		HostPattern:       getEnvOrDefault("HOST_PATTERN", DefaultHostPattern),
-		HostReplacement:   getEnvOrDefault("HOST_REPLACEMENT", DefaultHostReplacement),
-		PathPattern:       getEnvOrDefault("PATH_PATTERN", DefaultPathPattern),
-		PathReplacement:   getEnvOrDefault("PATH_REPLACEMENT", DefaultPathReplacement),
+		SchemePattern:      getEnvOrDefault("SCHEME_PATTERN", DefaultSchemePattern),
+		SchemeReplacement:  getEnvOrDefault("SCHEME_REPLACEMENT", DefaultSchemeReplacement),
+		HostPattern:        getEnvOrDefault("HOST_PATTERN", DefaultHostPattern),
+		HostReplacement:    getEnvOrDefault("HOST_REPLACEMENT", DefaultHostReplacement),
+		PathPattern:        getEnvOrDefault("PATH_PATTERN", DefaultPathPattern),
+		PathReplacement:    getEnvOrDefault("PATH_REPLACEMENT", DefaultPathReplacement),
+		PathDepth:          getEnvIntOrDefault("PATH_DEPTH", DefaultPathDepth),
+		VersionedPrefix:    getEnvBoolOrDefault("VERSIONED_PREFIX", false),
+		GopkgVersions:      getEnvBoolOrDefault("GOPKG_VERSIONS", false),
+		SourceForge:        getEnvOrDefault("SOURCE_FORGE", DefaultSourceForge),
+		SourceRef:          getEnvOrDefault("SOURCE_REF", DefaultSourceRef),
+		VCS:                getEnvOrDefault("VCS", DefaultVCS),
+		RewriteMode:        getEnvOrDefault("REWRITE_MODE", DefaultRewriteMode),
+		BrowserRedirect:    getEnvOrDefault("BROWSER_REDIRECT", DefaultBrowserRedirect),
+		KnownModulesOnly:   getEnvBoolOrDefault("KNOWN_MODULES_ONLY", false),
+		Modules:            getEnvList("MODULES"),
+		ModulesFile:        os.Getenv("MODULES_FILE"),
+		ServeModules:       getEnvBoolOrDefault("SERVE_MODULES", false),
+		CacheDir:           getEnvOrDefault("CACHE_DIR", DefaultCacheDir()),
+		Upstream:           os.Getenv("UPSTREAM_GOPROXY"),
+		GitProxy:           getEnvBoolOrDefault("GIT_PROXY", false),
+		GitCredentialsFile: os.Getenv("GIT_CREDENTIALS_FILE"),
+		AuthFile:           os.Getenv("AUTH_FILE"),
+		AuthTokens:         getEnvList("AUTH_TOKENS"),
+		Visibility:         getEnvOrDefault("VISIBILITY", DefaultVisibility),
+		TemplateDir:        os.Getenv("TEMPLATE_DIR"),
+		TrustedProxies:     getEnvList("TRUSTED_PROXIES"),
+		LogFormat:          getEnvOrDefault("LOG_FORMAT", DefaultLogFormat),
+		MetricsPath:        getEnvOrDefault("METRICS_PATH", DefaultMetricsPath),
+		TraceExporter:      getEnvOrDefault("TRACE_EXPORTER", DefaultTraceExporter),
+	}
+}
+
+// NewConfig creates a new instance of Config from environment variables and the configuration file
+// named by CONFIG_FILE, if set. See LoadConfig.
+func NewConfig() (*Config, error) {
+	return LoadConfig(os.Getenv("CONFIG_FILE"))
+}
+
+// LoadConfig creates a new instance of Config from environment variables, applies the configuration file
+// at path if not empty, reads the modules files, and validates the result.
+func LoadConfig(path string) (*Config, error) {
+	cfg := NewConfigFromEnvironment()
+	if path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.LoadModulesFile(); err != nil {
+		return nil, err
+	}
+	if err := cfg.LoadAuthFile(); err != nil {
+		return nil, err
+	}
+	if err := cfg.LoadTemplates(); err != nil {
+		return nil, err
+	}
+	for _, hostCfg := range cfg.Hosts {
+		if err := hostCfg.LoadModulesFile(); err != nil {
+			return nil, err
+		}
+		if err := hostCfg.LoadTemplates(); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadFile reads a JSON configuration file on top of the current configuration.
+// Values present in the file take precedence over the current ones.
+func (cfg *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	for host, hostCfg := range cfg.Hosts {
+		if hostCfg == nil {
+			return fmt.Errorf("parsing %s: host %q has no configuration", path, host)
+		}
+		hostCfg.inherit(host, cfg)
+	}
+	return nil
+}
+
+// LoadModulesFile appends the module paths listed in ModulesFile, if set, to Modules.
+// Blank lines and lines starting with # are ignored.
+func (cfg *Config) LoadModulesFile() error {
+	if cfg.ModulesFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(cfg.ModulesFile)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cfg.Modules = append(cfg.Modules, line)
+	}
+	return nil
+}
+
+// inherit fills the settings a virtual host configuration leaves unset from its parent configuration.
+// Rules and the catalogue are not inherited, and the host pattern defaults to the name of the virtual host.
+func (cfg *Config) inherit(host string, parent *Config) {
+	inheritString := func(value *string, parentValue string) {
+		if *value == "" {
+			*value = parentValue
+		}
+	}
+
+	inheritString(&cfg.SchemePattern, parent.SchemePattern)
+	inheritString(&cfg.SchemeReplacement, parent.SchemeReplacement)
+	inheritString(&cfg.HostPattern, host)
+	inheritString(&cfg.HostReplacement, parent.HostReplacement)
+	inheritString(&cfg.PathPattern, parent.PathPattern)
+	inheritString(&cfg.PathReplacement, parent.PathReplacement)
+	inheritString(&cfg.SourceForge, parent.SourceForge)
+	inheritString(&cfg.SourceRef, parent.SourceRef)
+	inheritString(&cfg.VCS, parent.VCS)
+	inheritString(&cfg.RewriteMode, parent.RewriteMode)
+	inheritString(&cfg.BrowserRedirect, parent.BrowserRedirect)
+	inheritString(&cfg.GitCredentialsFile, parent.GitCredentialsFile)
+	inheritString(&cfg.Visibility, parent.Visibility)
+	inheritString(&cfg.TemplateDir, parent.TemplateDir)
+	if cfg.PathDepth == 0 {
+		cfg.PathDepth = parent.PathDepth
+	}
+	cfg.VersionedPrefix = cfg.VersionedPrefix || parent.VersionedPrefix
+	cfg.GopkgVersions = cfg.GopkgVersions || parent.GopkgVersions
+	cfg.KnownModulesOnly = cfg.KnownModulesOnly || parent.KnownModulesOnly
+	cfg.GitProxy = cfg.GitProxy || parent.GitProxy
+}
+
+// ForHost returns the configuration serving the given virtual host.
+// Without any additional hosts configured, every host is served by cfg itself.
+func (cfg *Config) ForHost(host string) (*Config, bool) {
+	if len(cfg.Hosts) == 0 {
+		return cfg, true
+	}
+
+	// Try the host as given, then without its port.
+	candidates := []string{host}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		candidates = append(candidates, hostname)
+	}
+
+	for _, candidate := range candidates {
+		if hostCfg, ok := cfg.Hosts[candidate]; ok {
+			return hostCfg, true
+		}
+		if candidate == cfg.HostPattern {
+			return cfg, true
+		}
+	}
+	return nil, false
+}
+
+// validateVCSAndForge checks a VCS and source forge pair against the supported values. Empty values are allowed.
+func validateVCSAndForge(vcs, forge string) error {
+	if vcs != "" && !supportedVCS[vcs] {
+		return fmt.Errorf("unsupported vcs %q", vcs)
+	}
+	if forge != "" && forge != ForgeNone {
+		if _, ok := sourceTemplates[forge]; !ok {
+			return fmt.Errorf("unsupported source forge %q", forge)
+		}
+	}
+	return nil
+}
+
+// Validate checks the configuration for values that would produce responses the go command rejects,
+// or that would serve private repositories to anonymous clients.
+func (cfg *Config) Validate() error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	// Authentication applies to all virtual hosts, so it can only be configured at the top level.
+	for host, hostCfg := range cfg.Hosts {
+		if hostCfg.AuthFile != "" || len(hostCfg.AuthTokens) > 0 {
+			return fmt.Errorf("host %q: authFile and authTokens can only be set at the top level", host)
+		}
+	}
+
+	// GitProxy adds its credentials to the requests of any client, which must therefore authenticate.
+	if !cfg.AuthEnabled() {
+		if cfg.usesGitCredentials(nil) {
+			return errors.New("gitProxy with git credentials requires authFile or authTokens")
+		}
+		for host, hostCfg := range cfg.Hosts {
+			if hostCfg.usesGitCredentials(cfg) {
+				return fmt.Errorf("host %q: gitProxy with git credentials requires authFile or authTokens", host)
+			}
+		}
+	}
+	return nil
+}
+
+// usesGitCredentials reports whether GitProxy is enabled with credentials for any repository, taking the
+// settings inherited from parent, if not nil, into account.
+func (cfg *Config) usesGitCredentials(parent *Config) bool {
+	gitProxy, credentialsFile := cfg.GitProxy, cfg.GitCredentialsFile
+	if parent != nil {
+		gitProxy = gitProxy || parent.GitProxy
+		if credentialsFile == "" {
+			credentialsFile = parent.GitCredentialsFile
+		}
+	}
+	if !gitProxy {
+		return false
+	}
+	if credentialsFile != "" {
+		return true
+	}
+	for _, rule := range cfg.Rules {
+		if rule.CredentialsFile != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the settings of a configuration and its virtual hosts that don't depend on each other.
+func (cfg *Config) validate() error {
+	if err := validateVCSAndForge(cfg.VCS, cfg.SourceForge); err != nil {
+		return err
+	}
+
+	for i, rule := range cfg.Rules {
+		if rule.Module == "" {
+			return fmt.Errorf("rule %d: missing module", i)
+		}
+		if strings.Contains(rule.Module, "://") || strings.HasSuffix(rule.Module, "/") {
+			return fmt.Errorf("rule %d: module %q must be an import path", i, rule.Module)
+		}
+		if rule.Repository == "" {
+			return fmt.Errorf("rule %d: missing repository", i)
+		}
+		if _, err := url.Parse(rule.Repository); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		if err := validateVCSAndForge(rule.VCS, rule.SourceForge); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		if err := validateVisibility(rule.Visibility); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+
+	// An empty token would match requests without any credentials.
+	for i, token := range cfg.AuthTokens {
+		if strings.TrimSpace(token) == "" {
+			return fmt.Errorf("auth token %d: empty token", i)
+		}
+	}
+
+	for i, entry := range cfg.Catalogue {
+		if entry.ImportPath == "" || strings.Contains(entry.ImportPath, "://") {
+			return fmt.Errorf("catalogue entry %d: import path %q must be an import path", i, entry.ImportPath)
+		}
+	}
+
+	switch cfg.RewriteMode {
+	case "", RewriteModeLiteral:
+	case RewriteModeRegexp:
+		if len(cfg.RewriteRules) == 0 {
+			return fmt.Errorf("rewrite mode %q requires rewrite rules", cfg.RewriteMode)
+		}
+	default:
+		return fmt.Errorf("unsupported rewrite mode %q", cfg.RewriteMode)
+	}
+
+	// Compile the rewrite rules once, rather than for every request.
+	for i, rule := range cfg.RewriteRules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return fmt.Errorf("rewrite rule %d: %w", i, err)
+		}
+		cfg.RewriteRules[i].re = re
+	}
+
+	if err := validateBrowserRedirect(cfg.BrowserRedirect); err != nil {
+		return err
+	}
+
+	if _, err := parseUpstream(cfg.Upstream); err != nil {
+		return err
+	}
+
+	if err := validateVisibility(cfg.Visibility); err != nil {
+		return err
+	}
+
+	if _, err := ParseTrustedProxies(cfg.TrustedProxies); err != nil {
+		return err
+	}
+
+	if err := validateLogFormat(cfg.LogFormat); err != nil {
+		return err
+	}
+
+	if err := validateMetricsPath(cfg.MetricsPath); err != nil {
+		return err
+	}
+
+	if err := validateTraceExporter(cfg.TraceExporter); err != nil {
+		return err
+	}
+
+	for host, hostCfg := range cfg.Hosts {
+		if hostCfg == nil {
+			return fmt.Errorf("host %q: missing configuration", host)
+		}
+		if len(hostCfg.Hosts) > 0 {
+			return fmt.Errorf("host %q: virtual hosts cannot be nested", host)
+		}
+		if err := hostCfg.validate(); err != nil {
+			return fmt.Errorf("host %q: %w", host, err)
+		}
+	}
+	return nil
+}
+
+// MatchRule returns the rule whose module is the given import path or one of its parents.
+// If several rules match, the one with the longest module path wins. Returns nil if no rule matches.
+func (cfg *Config) MatchRule(importPath string) *Rule {
+	var match *Rule
+	for i, rule := range cfg.Rules {
+		if importPath != rule.Module && !strings.HasPrefix(importPath, rule.Module+"/") {
+			continue
+		}
+		if match == nil || len(rule.Module) > len(match.Module) {
+			match = &cfg.Rules[i]
+		}
+	}
+	return match
+}
+
+// MatchModule returns the module listed in Modules that is the given import path or one of its parents.
+// If several modules match, the longest one wins. Returns an empty string if no module matches.
+func (cfg *Config) MatchModule(importPath string) string {
+	var match string
+	for _, module := range cfg.Modules {
+		if importPath != module && !strings.HasPrefix(importPath, module+"/") {
+			continue
+		}
+		if len(module) > len(match) {
+			match = module
+		}
+	}
+	return match
+}
+
+// IsKnownModule reports whether a package path belongs to a module listed in Modules or mapped by a rule.
+func (cfg *Config) IsKnownModule(packagePath string) bool {
+	return cfg.MatchRule(packagePath) != nil || cfg.MatchModule(packagePath) != ""
+}
+
+// RoutesModule reports whether a module path belongs to this proxy: its host is one of the served
+// vanity hosts, or it is mapped by a rule.
+func (cfg *Config) RoutesModule(modulePath string) bool {
+	host, _, _ := strings.Cut(modulePath, "/")
+	if len(cfg.Hosts) > 0 {
+		_, ok := cfg.ForHost(host)
+		return ok
+	}
+	return host == cfg.HostPattern || cfg.MatchRule(modulePath) != nil
+}
+
+// KnownModules returns the module paths listed in Modules or mapped by a rule, of this configuration and
+// all of its virtual hosts, without duplicates.
+func (cfg *Config) KnownModules() []string {
+	var modules []string
+	seen := make(map[string]bool)
+	add := func(c *Config) {
+		for _, rule := range c.Rules {
+			if !seen[rule.Module] {
+				seen[rule.Module] = true
+				modules = append(modules, rule.Module)
+			}
+		}
+		for _, module := range c.Modules {
+			if !seen[module] {
+				seen[module] = true
+				modules = append(modules, module)
+			}
+		}
+	}
+
+	add(cfg)
+	hosts := make([]string, 0, len(cfg.Hosts))
+	for host := range cfg.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		add(cfg.Hosts[host])
+	}
+	return modules
+}
+
+// GetVCS returns the version control system to advertise for a package path: that of the matching rule,
+// else the configured one, else DefaultVCS.
+func (cfg *Config) GetVCS(packagePath string) string {
+	if rule := cfg.MatchRule(packagePath); rule != nil && rule.VCS != "" {
+		return rule.VCS
+	}
+	if cfg.VCS == "" {
+		return DefaultVCS
+	}
+	return cfg.VCS
+}
+
+// GetSourceForge returns the source forge for a package path: that of the matching rule, else the configured one.
+func (cfg *Config) GetSourceForge(packagePath string) string {
+	if rule := cfg.MatchRule(packagePath); rule != nil && rule.SourceForge != "" {
+		return rule.SourceForge
+	}
+	return cfg.SourceForge
+}
+
+// GetGitCredentialsFile returns the credentials file GitProxy uses for the repository of a package path:
+// that of the matching rule, else the configured one.
+func (cfg *Config) GetGitCredentialsFile(packagePath string) string {
+	if rule := cfg.MatchRule(packagePath); rule != nil && rule.CredentialsFile != "" {
+		return rule.CredentialsFile
 	}
+	return cfg.GitCredentialsFile
 }
@@ -2,6 +2,7 @@ package modproxy
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -25,29 +26,294 @@ var configFromEnvTestCases = []ConfigFromEnvTestCase{
 			HostReplacement:   DefaultHostReplacement,
 			PathPattern:       DefaultPathPattern,
 			PathReplacement:   DefaultPathReplacement,
+			PathDepth:         DefaultPathDepth,
+			SourceForge:       DefaultSourceForge,
+			SourceRef:         DefaultSourceRef,
+			VCS:               DefaultVCS,
+			RewriteMode:       DefaultRewriteMode,
+			BrowserRedirect:   DefaultBrowserRedirect,
+			CacheDir:          DefaultCacheDir(),
+			Visibility:        DefaultVisibility,
+			LogFormat:         DefaultLogFormat,
+			MetricsPath:       DefaultMetricsPath,
+			TraceExporter:     DefaultTraceExporter,
 		},
 	},
 	{
 		name: "Custom environment variables",
 		envVars: map[string]string{
-			"SCHEME_PATTERN":     "pattern",
-			"SCHEME_REPLACEMENT": "replacement",
-			"HOST_PATTERN":       "host.pattern",
-			"HOST_REPLACEMENT":   "host.replacement",
-			"PATH_PATTERN":       "path/pattern",
-			"PATH_REPLACEMENT":   "path/replacement",
+			"SCHEME_PATTERN":       "pattern",
+			"SCHEME_REPLACEMENT":   "replacement",
+			"HOST_PATTERN":         "host.pattern",
+			"HOST_REPLACEMENT":     "host.replacement",
+			"PATH_PATTERN":         "path/pattern",
+			"PATH_REPLACEMENT":     "path/replacement",
+			"PATH_DEPTH":           "2",
+			"VERSIONED_PREFIX":     "true",
+			"GOPKG_VERSIONS":       "1",
+			"SOURCE_FORGE":         "gitlab",
+			"SOURCE_REF":           "develop",
+			"VCS":                  "hg",
+			"REWRITE_MODE":         "regexp",
+			"BROWSER_REDIRECT":     "pkgsite",
+			"KNOWN_MODULES_ONLY":   "true",
+			"MODULES":              "go.loafoe.dev/modproxy, go.loafoe.dev/bitfield",
+			"MODULES_FILE":         "modules.txt",
+			"SERVE_MODULES":        "true",
+			"CACHE_DIR":            "/var/cache/modproxy",
+			"UPSTREAM_GOPROXY":     "https://proxy.golang.org",
+			"GIT_PROXY":            "true",
+			"GIT_CREDENTIALS_FILE": "/run/secrets/git",
+			"AUTH_FILE":            "/run/secrets/htpasswd",
+			"AUTH_TOKENS":          "ci-token, deploy-token",
+			"VISIBILITY":           "public",
+			"TEMPLATE_DIR":         "/etc/modproxy/templates",
+			"TRUSTED_PROXIES":      "10.0.0.0/8, 192.168.1.1",
+			"LOG_FORMAT":           "json",
+			"METRICS_PATH":         "/.modproxy/metrics",
+			"TRACE_EXPORTER":       "otlp",
 		},
 		expectedConfig: Config{
-			SchemePattern:     "pattern",
-			SchemeReplacement: "replacement",
-			HostPattern:       "host.pattern",
-			HostReplacement:   "host.replacement",
-			PathPattern:       "path/pattern",
-			PathReplacement:   "path/replacement",
+			SchemePattern:      "pattern",
+			SchemeReplacement:  "replacement",
+			HostPattern:        "host.pattern",
+			HostReplacement:    "host.replacement",
+			PathPattern:        "path/pattern",
+			PathReplacement:    "path/replacement",
+			PathDepth:          2,
+			VersionedPrefix:    true,
+			GopkgVersions:      true,
+			SourceForge:        "gitlab",
+			SourceRef:          "develop",
+			VCS:                "hg",
+			RewriteMode:        "regexp",
+			BrowserRedirect:    "pkgsite",
+			KnownModulesOnly:   true,
+			Modules:            []string{"go.loafoe.dev/modproxy", "go.loafoe.dev/bitfield"},
+			ModulesFile:        "modules.txt",
+			ServeModules:       true,
+			CacheDir:           "/var/cache/modproxy",
+			Upstream:           "https://proxy.golang.org",
+			GitProxy:           true,
+			GitCredentialsFile: "/run/secrets/git",
+			AuthFile:           "/run/secrets/htpasswd",
+			AuthTokens:         []string{"ci-token", "deploy-token"},
+			Visibility:         VisibilityPublic,
+			TemplateDir:        "/etc/modproxy/templates",
+			TrustedProxies:     []string{"10.0.0.0/8", "192.168.1.1"},
+			LogFormat:          LogFormatJSON,
+			MetricsPath:        "/.modproxy/metrics",
+			TraceExporter:      TraceExporterOTLP,
 		},
 	},
 }
 
+type ValidateTestCase struct {
+	name        string
+	cfg         Config
+	expectError bool
+}
+
+var validateTestCases = []ValidateTestCase{
+	{
+		name: "Default configuration",
+		cfg:  Config{VCS: DefaultVCS, SourceForge: DefaultSourceForge},
+	},
+	{
+		name: "Empty configuration",
+		cfg:  Config{},
+	},
+	{
+		name: "Supported VCS",
+		cfg:  Config{VCS: "fossil"},
+	},
+	{
+		name: "Module proxy VCS",
+		cfg:  Config{VCS: "mod"},
+	},
+	{
+		name:        "Unsupported VCS",
+		cfg:         Config{VCS: "cvs"},
+		expectError: true,
+	},
+	{
+		name:        "Unsupported source forge",
+		cfg:         Config{VCS: DefaultVCS, SourceForge: "sourcehut"},
+		expectError: true,
+	},
+	{
+		name: "Valid rule",
+		cfg:  Config{Rules: []Rule{{Module: "go.loafoe.dev/legacy", Repository: "https://hg.example.org/legacy", VCS: "hg"}}},
+	},
+	{
+		name:        "Rule without module",
+		cfg:         Config{Rules: []Rule{{Repository: "https://github.com/loafoe-dev/go-legacy"}}},
+		expectError: true,
+	},
+	{
+		name:        "Rule with URL as module",
+		cfg:         Config{Rules: []Rule{{Module: "https://go.loafoe.dev/legacy", Repository: "https://github.com/loafoe-dev/go-legacy"}}},
+		expectError: true,
+	},
+	{
+		name:        "Rule without repository",
+		cfg:         Config{Rules: []Rule{{Module: "go.loafoe.dev/legacy"}}},
+		expectError: true,
+	},
+	{
+		name: "Regexp rewrite mode",
+		cfg:  Config{RewriteMode: RewriteModeRegexp, RewriteRules: []RewriteRule{{Match: `^go\.loafoe\.dev/x/([^/]+)`, Replace: "https://gitlab.com/loafoe/${1}-go"}}},
+	},
+	{
+		name:        "Regexp rewrite mode without rules",
+		cfg:         Config{RewriteMode: RewriteModeRegexp},
+		expectError: true,
+	},
+	{
+		name:        "Invalid rewrite rule pattern",
+		cfg:         Config{RewriteMode: RewriteModeRegexp, RewriteRules: []RewriteRule{{Match: `(`, Replace: "https://gitlab.com/loafoe/go"}}},
+		expectError: true,
+	},
+	{
+		name:        "Unsupported rewrite mode",
+		cfg:         Config{RewriteMode: "glob"},
+		expectError: true,
+	},
+	{
+		name: "Custom browser redirect",
+		cfg:  Config{BrowserRedirect: "https://docs.example.org/{import}"},
+	},
+	{
+		name:        "Unsupported browser redirect",
+		cfg:         Config{BrowserRedirect: "docs"},
+		expectError: true,
+	},
+	{
+		name: "Valid virtual host",
+		cfg:  Config{Hosts: map[string]*Config{"go.example.org": {VCS: "hg"}}},
+	},
+	{
+		name:        "Invalid virtual host",
+		cfg:         Config{Hosts: map[string]*Config{"go.example.org": {VCS: "cvs"}}},
+		expectError: true,
+	},
+	{
+		name:        "Nested virtual hosts",
+		cfg:         Config{Hosts: map[string]*Config{"go.example.org": {Hosts: map[string]*Config{"go.example.net": {}}}}},
+		expectError: true,
+	},
+	{
+		name: "Upstream proxies",
+		cfg:  Config{Upstream: "https://proxy.example.org|https://proxy.golang.org"},
+	},
+	{
+		name:        "Upstream direct",
+		cfg:         Config{Upstream: "https://proxy.golang.org,direct"},
+		expectError: true,
+	},
+	{
+		name:        "Unsupported visibility",
+		cfg:         Config{Visibility: "internal"},
+		expectError: true,
+	},
+	{
+		name:        "Rule with unsupported visibility",
+		cfg:         Config{Rules: []Rule{{Module: "go.loafoe.dev/legacy", Repository: "https://example.org/legacy", Visibility: "internal"}}},
+		expectError: true,
+	},
+	{
+		name: "Trusted proxies",
+		cfg:  Config{TrustedProxies: []string{"10.0.0.0/8", "2001:db8::/32", "192.168.1.1"}},
+	},
+	{
+		name:        "Invalid trusted proxy",
+		cfg:         Config{TrustedProxies: []string{"10.0.0.0/33"}},
+		expectError: true,
+	},
+	{
+		name:        "Unsupported log format",
+		cfg:         Config{LogFormat: "logfmt"},
+		expectError: true,
+	},
+	{
+		name:        "Relative metrics path",
+		cfg:         Config{MetricsPath: "metrics"},
+		expectError: true,
+	},
+	{
+		name:        "Unsupported trace exporter",
+		cfg:         Config{TraceExporter: "jaeger"},
+		expectError: true,
+	},
+	{
+		name:        "Catalogue entry with URL",
+		cfg:         Config{Catalogue: []CatalogueEntry{{ImportPath: "https://go.loafoe.dev/modproxy"}}},
+		expectError: true,
+	},
+	{
+		name:        "Git proxy with credentials and without authentication",
+		cfg:         Config{GitProxy: true, GitCredentialsFile: "/run/secrets/github"},
+		expectError: true,
+	},
+	{
+		name: "Git proxy with rule credentials and without authentication",
+		cfg: Config{
+			GitProxy: true,
+			Rules:    []Rule{{Module: "go.loafoe.dev/internal", Repository: "https://github.com/loafoe-dev/go-internal", CredentialsFile: "/run/secrets/github"}},
+		},
+		expectError: true,
+	},
+	{
+		name:        "Host with git proxy and inherited credentials without authentication",
+		cfg:         Config{GitCredentialsFile: "/run/secrets/github", Hosts: map[string]*Config{"go.example.org": {GitProxy: true}}},
+		expectError: true,
+	},
+	{
+		name: "Git proxy with credentials and authentication",
+		cfg: Config{
+			GitProxy:           true,
+			GitCredentialsFile: "/run/secrets/github",
+			AuthTokens:         []string{"secret"},
+			Hosts:              map[string]*Config{"go.example.org": {GitProxy: true}},
+		},
+	},
+	{
+		name: "Git proxy without credentials",
+		cfg:  Config{GitProxy: true},
+	},
+	{
+		name:        "Empty auth token",
+		cfg:         Config{AuthTokens: []string{"secret", ""}},
+		expectError: true,
+	},
+	{
+		name:        "Host with auth tokens",
+		cfg:         Config{Hosts: map[string]*Config{"go.example.org": {AuthTokens: []string{"secret"}}}},
+		expectError: true,
+	},
+	{
+		name:        "Host with auth file",
+		cfg:         Config{AuthTokens: []string{"secret"}, Hosts: map[string]*Config{"go.example.org": {AuthFile: "/run/secrets/htpasswd"}}},
+		expectError: true,
+	},
+	{
+		name:        "Rule with unsupported VCS",
+		cfg:         Config{Rules: []Rule{{Module: "go.loafoe.dev/legacy", Repository: "https://example.org/legacy", VCS: "cvs"}}},
+		expectError: true,
+	},
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range validateTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if (err != nil) != tc.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tc.expectError)
+			}
+		})
+	}
+}
+
 func TestNewConfigFromEnvironment(t *testing.T) {
 	for _, tc := range configFromEnvTestCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -71,3 +337,326 @@ func TestNewConfigFromEnvironment(t *testing.T) {
 		})
 	}
 }
+
+type LoadFileTestCase struct {
+	name           string
+	content        string
+	expectedConfig Config
+	expectError    bool
+}
+
+var loadFileTestCases = []LoadFileTestCase{
+	{
+		name: "Rules and overrides",
+		content: `{
+			"pathDepth": 2,
+			"rules": [
+				{"module": "go.loafoe.dev/legacy", "repository": "https://hg.example.org/legacy", "vcs": "hg"},
+				{"module": "go.loafoe.dev/other", "repository": "https://gitlab.com/other/go-other", "sourceForge": "gitlab"}
+			]
+		}`,
+		expectedConfig: Config{
+			HostPattern: DefaultHostPattern,
+			PathDepth:   2,
+			Rules: []Rule{
+				{Module: "go.loafoe.dev/legacy", Repository: "https://hg.example.org/legacy", VCS: "hg"},
+				{Module: "go.loafoe.dev/other", Repository: "https://gitlab.com/other/go-other", SourceForge: "gitlab"},
+			},
+		},
+	},
+	{
+		name: "Virtual hosts inherit unset settings",
+		content: `{
+			"hosts": {
+				"go.example.org": {"hostReplacement": "gitlab.com", "pathReplacement": "/example/", "vcs": "hg"}
+			}
+		}`,
+		expectedConfig: Config{
+			HostPattern: DefaultHostPattern,
+			PathDepth:   DefaultPathDepth,
+			Hosts: map[string]*Config{
+				"go.example.org": {
+					HostPattern:     "go.example.org",
+					HostReplacement: "gitlab.com",
+					PathReplacement: "/example/",
+					PathDepth:       DefaultPathDepth,
+					VCS:             "hg",
+				},
+			},
+		},
+	},
+	{
+		name:        "Virtual host without configuration",
+		content:     `{"hosts": {"go.example.org": null}}`,
+		expectError: true,
+	},
+	{
+		name:        "Unknown field",
+		content:     `{"rulez": []}`,
+		expectError: true,
+	},
+	{
+		name:        "Malformed JSON",
+		content:     `{"rules": [`,
+		expectError: true,
+	},
+}
+
+func TestLoadFile(t *testing.T) {
+	for _, tc := range loadFileTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tc.content), 0o600); err != nil {
+				t.Fatalf("Error writing config file: %v", err)
+			}
+
+			cfg := &Config{HostPattern: DefaultHostPattern, PathDepth: DefaultPathDepth}
+			err := cfg.LoadFile(path)
+
+			if (err != nil) != tc.expectError {
+				t.Errorf("LoadFile() error = %v, expectError %v", err, tc.expectError)
+				return
+			}
+
+			if !tc.expectError && !reflect.DeepEqual(cfg, &tc.expectedConfig) {
+				t.Errorf("LoadFile() = %+v, want %+v", cfg, &tc.expectedConfig)
+			}
+		})
+	}
+}
+
+type MatchRuleTestCase struct {
+	name           string
+	importPath     string
+	expectedModule string // Empty if no rule should match
+}
+
+var matchRuleTestCases = []MatchRuleTestCase{
+	{
+		name:           "Exact module",
+		importPath:     "go.loafoe.dev/tools",
+		expectedModule: "go.loafoe.dev/tools",
+	},
+	{
+		name:           "Subpackage of module",
+		importPath:     "go.loafoe.dev/tools/cmd/foo",
+		expectedModule: "go.loafoe.dev/tools",
+	},
+	{
+		name:           "Longest module wins",
+		importPath:     "go.loafoe.dev/tools/legacy/cmd",
+		expectedModule: "go.loafoe.dev/tools/legacy",
+	},
+	{
+		name:       "Partial path element",
+		importPath: "go.loafoe.dev/toolset",
+	},
+	{
+		name:       "No matching rule",
+		importPath: "go.loafoe.dev/modproxy",
+	},
+}
+
+func TestMatchRule(t *testing.T) {
+	cfg := &Config{
+		Rules: []Rule{
+			{Module: "go.loafoe.dev/tools", Repository: "https://github.com/loafoe-dev/tools"},
+			{Module: "go.loafoe.dev/tools/legacy", Repository: "https://hg.example.org/legacy"},
+		},
+	}
+
+	for _, tc := range matchRuleTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotModule string
+			if rule := cfg.MatchRule(tc.importPath); rule != nil {
+				gotModule = rule.Module
+			}
+			if gotModule != tc.expectedModule {
+				t.Errorf("MatchRule(%q) got module %q, want %q", tc.importPath, gotModule, tc.expectedModule)
+			}
+		})
+	}
+}
+
+type ForHostTestCase struct {
+	name         string
+	cfg          *Config
+	host         string
+	expectedHost string // HostPattern of the expected configuration, empty if the host is unknown
+}
+
+var forHostTestCases = []ForHostTestCase{
+	{
+		name:         "Without virtual hosts any host is served",
+		cfg:          &Config{HostPattern: "go.loafoe.dev"},
+		host:         "example.com",
+		expectedHost: "go.loafoe.dev",
+	},
+	{
+		name:         "Primary host",
+		cfg:          &Config{HostPattern: "go.loafoe.dev", Hosts: map[string]*Config{"go.example.org": {HostPattern: "go.example.org"}}},
+		host:         "go.loafoe.dev",
+		expectedHost: "go.loafoe.dev",
+	},
+	{
+		name:         "Virtual host",
+		cfg:          &Config{HostPattern: "go.loafoe.dev", Hosts: map[string]*Config{"go.example.org": {HostPattern: "go.example.org"}}},
+		host:         "go.example.org",
+		expectedHost: "go.example.org",
+	},
+	{
+		name:         "Virtual host with port",
+		cfg:          &Config{HostPattern: "go.loafoe.dev", Hosts: map[string]*Config{"go.example.org": {HostPattern: "go.example.org"}}},
+		host:         "go.example.org:8080",
+		expectedHost: "go.example.org",
+	},
+	{
+		name: "Unknown host",
+		cfg:  &Config{HostPattern: "go.loafoe.dev", Hosts: map[string]*Config{"go.example.org": {HostPattern: "go.example.org"}}},
+		host: "go.unknown.net",
+	},
+}
+
+func TestForHost(t *testing.T) {
+	for _, tc := range forHostTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hostCfg, ok := tc.cfg.ForHost(tc.host)
+			if ok != (tc.expectedHost != "") {
+				t.Fatalf("ForHost(%q) ok = %v, want %v", tc.host, ok, tc.expectedHost != "")
+			}
+			if ok && hostCfg.HostPattern != tc.expectedHost {
+				t.Errorf("ForHost(%q) got host %q, want %q", tc.host, hostCfg.HostPattern, tc.expectedHost)
+			}
+		})
+	}
+}
+
+func TestLoadModulesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "modules.txt")
+	content := "# Vanity modules\ngo.loafoe.dev/bitfield\n\n  go.loafoe.dev/legacy  \n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Error writing modules file: %v", err)
+	}
+
+	cfg := &Config{Modules: []string{"go.loafoe.dev/modproxy"}, ModulesFile: path}
+	if err := cfg.LoadModulesFile(); err != nil {
+		t.Fatalf("LoadModulesFile() error = %v", err)
+	}
+
+	want := []string{"go.loafoe.dev/modproxy", "go.loafoe.dev/bitfield", "go.loafoe.dev/legacy"}
+	if !reflect.DeepEqual(cfg.Modules, want) {
+		t.Errorf("LoadModulesFile() got modules %v, want %v", cfg.Modules, want)
+	}
+
+	cfg = &Config{ModulesFile: filepath.Join(t.TempDir(), "missing.txt")}
+	if err := cfg.LoadModulesFile(); err == nil {
+		t.Errorf("LoadModulesFile() with missing file did not return an error")
+	}
+}
+
+type IsKnownModuleTestCase struct {
+	name        string
+	packagePath string
+	expected    bool
+}
+
+var isKnownModuleTestCases = []IsKnownModuleTestCase{
+	{
+		name:        "Listed module",
+		packagePath: "go.loafoe.dev/modproxy",
+		expected:    true,
+	},
+	{
+		name:        "Package of listed module",
+		packagePath: "go.loafoe.dev/modproxy/internal",
+		expected:    true,
+	},
+	{
+		name:        "Module mapped by rule",
+		packagePath: "go.loafoe.dev/legacy",
+		expected:    true,
+	},
+	{
+		name:        "Partial path element",
+		packagePath: "go.loafoe.dev/modproxyfoo",
+		expected:    false,
+	},
+	{
+		name:        "Unknown module",
+		packagePath: "go.loafoe.dev/favicon.ico",
+		expected:    false,
+	},
+}
+
+func TestIsKnownModule(t *testing.T) {
+	cfg := &Config{
+		Modules: []string{"go.loafoe.dev/modproxy"},
+		Rules:   []Rule{{Module: "go.loafoe.dev/legacy", Repository: "https://hg.example.org/legacy"}},
+	}
+
+	for _, tc := range isKnownModuleTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := cfg.IsKnownModule(tc.packagePath); got != tc.expected {
+				t.Errorf("IsKnownModule(%q) = %v, want %v", tc.packagePath, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestMatchModule(t *testing.T) {
+	cfg := &Config{Modules: []string{"go.loafoe.dev/tools", "go.loafoe.dev/tools/cli"}}
+
+	tests := map[string]string{
+		"go.loafoe.dev/tools":            "go.loafoe.dev/tools",
+		"go.loafoe.dev/tools/other":      "go.loafoe.dev/tools",
+		"go.loafoe.dev/tools/cli":        "go.loafoe.dev/tools/cli",
+		"go.loafoe.dev/tools/cli/v2/cmd": "go.loafoe.dev/tools/cli",
+		"go.loafoe.dev/toolsmith":        "",
+	}
+	for importPath, want := range tests {
+		if got := cfg.MatchModule(importPath); got != want {
+			t.Errorf("MatchModule(%q) = %q, want %q", importPath, got, want)
+		}
+	}
+}
+
+func TestKnownModules(t *testing.T) {
+	cfg := &Config{
+		Modules: []string{"go.loafoe.dev/modproxy", "go.loafoe.dev/legacy"},
+		Rules:   []Rule{{Module: "go.loafoe.dev/legacy", Repository: "https://hg.example.org/legacy"}},
+		Hosts: map[string]*Config{
+			"go.example.org": {Modules: []string{"go.example.org/tool"}},
+		},
+	}
+
+	want := []string{"go.loafoe.dev/legacy", "go.loafoe.dev/modproxy", "go.example.org/tool"}
+	if got := cfg.KnownModules(); !reflect.DeepEqual(got, want) {
+		t.Errorf("KnownModules() = %v, want %v", got, want)
+	}
+}
+
+func TestRoutesModule(t *testing.T) {
+	cfg := &Config{
+		HostPattern: "go.loafoe.dev",
+		Rules:       []Rule{{Module: "example.org/legacy", Repository: "https://hg.example.org/legacy"}},
+	}
+	virtual := &Config{HostPattern: "go.loafoe.dev", Hosts: map[string]*Config{"go.example.org": {HostPattern: "go.example.org"}}}
+
+	testCases := []struct {
+		cfg        *Config
+		modulePath string
+		expected   bool
+	}{
+		{cfg, "go.loafoe.dev/modproxy", true},
+		{cfg, "example.org/legacy/v2", true},
+		{cfg, "golang.org/x/mod", false},
+		{virtual, "go.example.org/tool", true},
+		{virtual, "go.loafoe.dev/modproxy", true},
+		{virtual, "golang.org/x/mod", false},
+	}
+	for _, tc := range testCases {
+		if got := tc.cfg.RoutesModule(tc.modulePath); got != tc.expected {
+			t.Errorf("RoutesModule(%q) = %v, want %v", tc.modulePath, got, tc.expected)
+		}
+	}
+}
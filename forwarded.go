@@ -0,0 +1,151 @@
+package modproxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseTrustedProxies parses a list of CIDR ranges and IP addresses of trusted reverse proxies.
+// Invalid entries are skipped, so they are never trusted, and the first of them is reported as error.
+func ParseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	var firstErr error
+	for _, value := range values {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(value)
+			if addrErr != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("trusted proxy %q: not a CIDR range or IP address", value)
+				}
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, firstErr
+}
+
+// isTrusted reports whether an address, optionally with port, lies within one of the trusted ranges.
+func isTrusted(addr string, trusted []netip.Prefix) bool {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip, err := netip.ParseAddr(strings.Trim(addr, "[]"))
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidForwardedHost reports whether a forwarded host is a plain host name or address, optionally with port.
+func isValidForwardedHost(host string) bool {
+	return host != "" && !strings.ContainsAny(host, " /\\?#@\"<>")
+}
+
+// forwardedElement is an element of the RFC 7239 Forwarded header.
+type forwardedElement struct {
+	forAddr, proto, host string
+}
+
+// splitQuoted splits s at sep, ignoring separators within quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseForwarded parses the elements of the Forwarded headers of a request, in order.
+func parseForwarded(header http.Header) []forwardedElement {
+	var elements []forwardedElement
+	for _, value := range header.Values("Forwarded") {
+		for _, element := range splitQuoted(value, ',') {
+			var e forwardedElement
+			for _, pair := range splitQuoted(element, ';') {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found {
+					continue
+				}
+				value = strings.Trim(value, `"`)
+				switch strings.ToLower(key) {
+				case "for":
+					e.forAddr = value
+				case "proto":
+					e.proto = strings.ToLower(value)
+				case "host":
+					e.host = value
+				}
+			}
+			elements = append(elements, e)
+		}
+	}
+	return elements
+}
+
+// lastHeaderValue returns the last value of a comma-separated header, which was set by the nearest proxy.
+func lastHeaderValue(header http.Header, key string) string {
+	values := header.Values(key)
+	if len(values) == 0 {
+		return ""
+	}
+	parts := strings.Split(values[len(values)-1], ",")
+	return strings.TrimSpace(parts[len(parts)-1])
+}
+
+// forwardedSchemeAndHost returns the scheme and host of the original request as reported by trusted proxies.
+// The Forwarded header is walked from the nearest proxy outwards, skipping elements added on behalf of other
+// trusted proxies, so that values made up by the client are never used. Without a Forwarded header, the last
+// values of X-Forwarded-Proto and X-Forwarded-Host are used. Empty values mean the proxies did not report them.
+func forwardedSchemeAndHost(r *http.Request, trusted []netip.Prefix) (scheme, host string) {
+	if elements := parseForwarded(r.Header); len(elements) > 0 {
+		i := len(elements) - 1
+		for i > 0 && isTrusted(elements[i].forAddr, trusted) {
+			i--
+		}
+		return elements[i].proto, elements[i].host
+	}
+	return strings.ToLower(lastHeaderValue(r.Header, "X-Forwarded-Proto")), lastHeaderValue(r.Header, "X-Forwarded-Host")
+}
+
+// GetForwardedRequestURL constructs the full request URL like GetRequestURL, but honours the scheme and host
+// reported in the Forwarded, X-Forwarded-Proto and X-Forwarded-Host headers if the request comes from one of
+// the trusted proxies. The headers of other clients are ignored, so they cannot spoof the host.
+func GetForwardedRequestURL(r *http.Request, trusted []netip.Prefix) string {
+	requestURL := GetRequestURL(r)
+	if !isTrusted(r.RemoteAddr, trusted) {
+		return requestURL
+	}
+
+	scheme, rest, _ := strings.Cut(requestURL, "://")
+	host, path, _ := strings.Cut(rest, "/")
+
+	forwardedScheme, forwardedHost := forwardedSchemeAndHost(r, trusted)
+	if forwardedScheme == "http" || forwardedScheme == "https" {
+		scheme = forwardedScheme
+	}
+	if isValidForwardedHost(forwardedHost) {
+		host = forwardedHost
+	}
+	return scheme + "://" + host + "/" + path
+}
@@ -0,0 +1,149 @@
+package modproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := ParseTrustedProxies([]string{"10.1.2.3/8", "192.168.1.1", "bogus", "2001:db8::1"})
+	if err == nil {
+		t.Errorf("ParseTrustedProxies() error = nil, want error for invalid entry")
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.1/32"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+	}
+	if len(prefixes) != len(want) {
+		t.Fatalf("ParseTrustedProxies() = %v, want %v", prefixes, want)
+	}
+	for i := range want {
+		if prefixes[i] != want[i] {
+			t.Errorf("ParseTrustedProxies()[%d] = %v, want %v", i, prefixes[i], want[i])
+		}
+	}
+}
+
+type ForwardedRequestURLTestCase struct {
+	name        string
+	remoteAddr  string
+	headers     map[string][]string
+	expectedURL string
+}
+
+var forwardedRequestURLTestCases = []ForwardedRequestURLTestCase{
+	{
+		name:        "Trusted proxy without headers",
+		remoteAddr:  "10.0.0.1:1234",
+		expectedURL: "http://go.loafoe.dev/modproxy?go-get=1",
+	},
+	{
+		name:       "X-Forwarded headers from trusted proxy",
+		remoteAddr: "10.0.0.1:1234",
+		headers: map[string][]string{
+			"X-Forwarded-Proto": {"https"},
+			"X-Forwarded-Host":  {"vanity.example.org"},
+		},
+		expectedURL: "https://vanity.example.org/modproxy?go-get=1",
+	},
+	{
+		name:       "X-Forwarded headers from untrusted client",
+		remoteAddr: "203.0.113.7:1234",
+		headers: map[string][]string{
+			"X-Forwarded-Proto": {"https"},
+			"X-Forwarded-Host":  {"evil.example.com"},
+		},
+		expectedURL: "http://go.loafoe.dev/modproxy?go-get=1",
+	},
+	{
+		name:       "X-Forwarded headers use the value of the nearest proxy",
+		remoteAddr: "10.0.0.1:1234",
+		headers: map[string][]string{
+			"X-Forwarded-Proto": {"http, https"},
+			"X-Forwarded-Host":  {"evil.example.com", "vanity.example.org"},
+		},
+		expectedURL: "https://vanity.example.org/modproxy?go-get=1",
+	},
+	{
+		name:       "Unsupported forwarded proto and invalid host",
+		remoteAddr: "10.0.0.1:1234",
+		headers: map[string][]string{
+			"X-Forwarded-Proto": {"javascript"},
+			"X-Forwarded-Host":  {"evil.example.com/path"},
+		},
+		expectedURL: "http://go.loafoe.dev/modproxy?go-get=1",
+	},
+	{
+		name:       "Forwarded header from trusted proxy",
+		remoteAddr: "10.0.0.1:1234",
+		headers: map[string][]string{
+			"Forwarded": {`for=203.0.113.7;proto=https;host="vanity.example.org:8443"`},
+		},
+		expectedURL: "https://vanity.example.org:8443/modproxy?go-get=1",
+	},
+	{
+		name:       "Forwarded header takes precedence over X-Forwarded headers",
+		remoteAddr: "10.0.0.1:1234",
+		headers: map[string][]string{
+			"Forwarded":        {"for=203.0.113.7;proto=https;host=vanity.example.org"},
+			"X-Forwarded-Host": {"other.example.org"},
+		},
+		expectedURL: "https://vanity.example.org/modproxy?go-get=1",
+	},
+	{
+		name:       "Forwarded header skips elements of trusted proxies",
+		remoteAddr: "10.0.0.1:1234",
+		headers: map[string][]string{
+			"Forwarded": {
+				"for=198.51.100.1;proto=http;host=evil.example.com, for=203.0.113.7;proto=https;host=vanity.example.org",
+				`for="[2001:db8::1]:4711";proto=http;host=internal.example.org`,
+			},
+		},
+		expectedURL: "https://vanity.example.org/modproxy?go-get=1",
+	},
+	{
+		name:       "Forwarded header from untrusted client",
+		remoteAddr: "203.0.113.7:1234",
+		headers: map[string][]string{
+			"Forwarded": {"for=198.51.100.1;proto=https;host=evil.example.com"},
+		},
+		expectedURL: "http://go.loafoe.dev/modproxy?go-get=1",
+	},
+}
+
+func TestGetForwardedRequestURL(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range forwardedRequestURLTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://go.loafoe.dev/modproxy?go-get=1", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for key, values := range tc.headers {
+				for _, value := range values {
+					req.Header.Add(key, value)
+				}
+			}
+
+			gotURL := GetForwardedRequestURL(req, trusted)
+			if gotURL != tc.expectedURL {
+				t.Errorf("GetForwardedRequestURL() = %v, want %v", gotURL, tc.expectedURL)
+			}
+		})
+	}
+}
+
+func TestDefaultRequestURLGetterWithoutTrustedProxies(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://go.loafoe.dev/modproxy", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-Host", "evil.example.com")
+
+	if got := (DefaultRequestURLGetter{}).GetRequestURL(req); got != "http://go.loafoe.dev/modproxy" {
+		t.Errorf("GetRequestURL() = %v, want http://go.loafoe.dev/modproxy", got)
+	}
+}
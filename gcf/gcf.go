@@ -0,0 +1,28 @@
+// Package gcf registers modproxy with the Functions Framework as the HTTP function ModProxy,
+// configured from the environment. Blank-import it to deploy modproxy as a Cloud Function.
+package gcf
+
+import (
+	"context"
+	"log"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"go.loafoe.dev/modproxy"
+)
+
+// init registers the ModProxy function as an HTTP-triggered function using environment variables.
+func init() {
+	// Initialize configuration.
+	cfg, err := modproxy.NewConfig()
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	// Export spans if configured. Functions have no shutdown hook, so spans are flushed in batches as they go.
+	if _, err := modproxy.SetupTracing(context.Background(), cfg); err != nil {
+		log.Fatalf("modproxy.SetupTracing: %v", err)
+	}
+
+	// Register the ModProxy handler with the configuration.
+	functions.HTTP("ModProxy", modproxy.NewHandler(cfg).ServeHTTP)
+}
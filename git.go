@@ -0,0 +1,177 @@
+package modproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultRefreshInterval is how long a local checkout is used before fetching updates from its origin again.
+const DefaultRefreshInterval = time.Minute
+
+// gitRepo is a local checkout of a remote git repository.
+type gitRepo struct {
+	url string
+	dir string
+
+	mu        sync.Mutex
+	lastFetch time.Time
+	// lastErr is the error of the last failed clone or fetch at failedAt, returned by sync for refreshInterval
+	// rather than asking the origin again.
+	lastErr  error
+	failedAt time.Time
+}
+
+// newGitRepo returns the local checkout of the repository at url, kept in a directory below cacheDir.
+// The checkout is created or updated by sync.
+func newGitRepo(cacheDir, url string) *gitRepo {
+	sum := sha256.Sum256([]byte(url))
+	return &gitRepo{
+		url: url,
+		dir: filepath.Join(cacheDir, hex.EncodeToString(sum[:])),
+	}
+}
+
+// git runs a git command in the local checkout and returns its standard output.
+func (r *gitRepo) git(ctx context.Context, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = r.dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// sync clones the repository if there is no local checkout yet, or fetches updates from its origin
+// if the checkout was last updated more than refreshInterval ago. Failures are cached for refreshInterval too,
+// so an unreachable or missing repository isn't asked for again on every request. Failures caused by ctx being
+// cancelled or timing out, e.g. because the client went away, say nothing about the repository and aren't cached.
+func (r *gitRepo) sync(ctx context.Context, refreshInterval time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.lastErr != nil && time.Since(r.failedAt) < refreshInterval {
+		return r.lastErr
+	}
+	err := r.update(ctx, refreshInterval)
+	if err != nil && ctx.Err() != nil {
+		return err
+	}
+	r.lastErr = err
+	if err != nil {
+		r.failedAt = time.Now()
+	}
+	return err
+}
+
+// update clones or fetches the repository as described for sync. The caller must hold r.mu.
+func (r *gitRepo) update(ctx context.Context, refreshInterval time.Duration) error {
+	if _, err := os.Stat(filepath.Join(r.dir, ".git")); err == nil {
+		if time.Since(r.lastFetch) < refreshInterval {
+			return nil
+		}
+		ctx, span := tracer.Start(ctx, "git fetch", trace.WithAttributes(attribute.String("modproxy.repo_url", r.url)))
+		_, err := r.git(ctx, "fetch", "--quiet", "--tags", "--prune", "--force", "origin")
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+		r.lastFetch = time.Now()
+		return nil
+	}
+
+	// Remove any partial checkout left behind by an interrupted clone.
+	if err := os.RemoveAll(r.dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+	ctx, span := tracer.Start(ctx, "git clone", trace.WithAttributes(attribute.String("modproxy.repo_url", r.url)))
+	_, err := r.git(ctx, "clone", "--quiet", "--no-checkout", r.url, ".")
+	endSpan(span, err)
+	if err != nil {
+		// Don't leave an empty directory behind for every repository that doesn't exist.
+		os.RemoveAll(r.dir)
+		return err
+	}
+	r.lastFetch = time.Now()
+	return nil
+}
+
+// tags returns the names of the tags starting with prefix.
+func (r *gitRepo) tags(ctx context.Context, prefix string) ([]string, error) {
+	out, err := r.git(ctx, "tag", "--list", prefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// hasTag reports whether a tag with the given name exists.
+func (r *gitRepo) hasTag(ctx context.Context, tag string) bool {
+	_, err := r.git(ctx, "rev-parse", "--quiet", "--verify", "refs/tags/"+tag+"^{commit}")
+	return err == nil
+}
+
+// commitTime returns the commit time of a revision.
+func (r *gitRepo) commitTime(ctx context.Context, rev string) (time.Time, error) {
+	out, err := r.git(ctx, "log", "-1", "--format=%cI", rev)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(out)))
+}
+
+// readFile returns the contents of a file at a revision.
+func (r *gitRepo) readFile(ctx context.Context, rev, path string) ([]byte, error) {
+	return r.git(ctx, "cat-file", "blob", rev+":"+path)
+}
+
+// hasFile reports whether a file exists at a revision.
+func (r *gitRepo) hasFile(ctx context.Context, rev, path string) bool {
+	_, err := r.git(ctx, "cat-file", "-e", rev+":"+path)
+	return err == nil
+}
+
+// lsRemoteTags returns the names of the tags of the remote repository at url, without cloning it.
+func lsRemoteTags(ctx context.Context, url string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "git ls-remote", trace.WithAttributes(attribute.String("modproxy.repo_url", url)))
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", "--tags", "--refs", url)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		err = fmt.Errorf("git ls-remote: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if _, ref, found := strings.Cut(line, "\t"); found {
+			tags = append(tags, strings.TrimPrefix(ref, "refs/tags/"))
+		}
+	}
+	return tags, nil
+}
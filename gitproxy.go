@@ -0,0 +1,174 @@
+package modproxy
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// GitPathPrefix is the path below which GitProxy serves the repositories of modules. Path elements starting
+// with a dot are not allowed in import paths, so the prefix never collides with a module.
+const GitPathPrefix = "/.modproxy/git"
+
+// Git smart-HTTP service paths relative to the repository URL. Only fetching is supported.
+const (
+	gitInfoRefsPath   = "/info/refs"
+	gitUploadPackPath = "/git-upload-pack"
+)
+
+// errOriginCredentials is returned when the origin rejects the credentials of the git proxy.
+var errOriginCredentials = errors.New("origin rejected credentials")
+
+// GitProxyURL returns the URL at which GitProxy serves the repository of a module, for requests to host using scheme.
+func GitProxyURL(scheme, host, packagePath string) string {
+	return scheme + "://" + host + GitPathPrefix + "/" + packagePath
+}
+
+// parseGitProxyPath splits a GitProxy request path into the import path of the repository and the git service path.
+func parseGitProxyPath(p string) (importPath, servicePath string, ok bool) {
+	rest, found := strings.CutPrefix(p, GitPathPrefix+"/")
+	if !found {
+		return "", "", false
+	}
+	for _, servicePath := range []string{gitInfoRefsPath, gitUploadPackPath} {
+		if importPath, found := strings.CutSuffix(rest, servicePath); found && importPath != "" {
+			return importPath, servicePath, true
+		}
+	}
+	return "", "", false
+}
+
+// readCredentials reads a credentials file holding "username:password". A file without a colon holds
+// just a password or token, which is sent with an empty username.
+func readCredentials(path string) (username, password string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	line = strings.TrimSpace(line)
+	if username, password, found := strings.Cut(line, ":"); found {
+		return username, password, nil
+	}
+	return "", line, nil
+}
+
+// GitProxy reverse-proxies the git smart-HTTP protocol to the repositories of modules, adding the credentials
+// configured for their origin, so that only the proxy needs access to private repositories.
+type GitProxy struct {
+	Config      *Config
+	URLGetter   RequestURLGetter
+	PathGetter  PackagePathGetter
+	URLRewriter URLRewriter
+	// Transport is used for requests to the origin. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+	// Logger logs the errors of the origin. If nil, slog.Default() is used.
+	Logger *slog.Logger
+}
+
+// NewGitProxy creates a new GitProxy with the provided configuration and dependencies.
+func NewGitProxy(cfg *Config, urlGetter RequestURLGetter, pathGetter PackagePathGetter, urlRewriter URLRewriter) *GitProxy {
+	return &GitProxy{
+		Config:      cfg,
+		URLGetter:   urlGetter,
+		PathGetter:  pathGetter,
+		URLRewriter: urlRewriter,
+	}
+}
+
+// ServeHTTP serves the info/refs and git-upload-pack endpoints of the repositories of modules
+// whose configuration enables GitProxy.
+func (p *GitProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	importPath, servicePath, ok := parseGitProxyPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	// Only allow fetching, never pushing.
+	if servicePath == gitInfoRefsPath && (r.Method != http.MethodGet || r.URL.Query().Get("service") != "git-upload-pack") ||
+		servicePath == gitUploadPackPath && r.Method != http.MethodPost {
+		http.Error(w, "Only fetching over git smart HTTP is supported", http.StatusForbidden)
+		return
+	}
+
+	requestURL, err := url.Parse(p.URLGetter.GetRequestURL(r))
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	cfg, packagePath, repoURL, err := resolveGitRepository(p.Config, p.PathGetter, p.URLRewriter, requestURL.Scheme, importPath)
+	if errors.Is(err, ErrModuleNotFound) || err == nil && (packagePath != importPath || !cfg.GitProxy) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	origin, err := url.Parse(repoURL)
+	if err != nil || (origin.Scheme != "http" && origin.Scheme != "https") {
+		http.Error(w, fmt.Sprintf("repository of %s is not served over HTTP", packagePath), http.StatusBadGateway)
+		return
+	}
+
+	var username, password string
+	if credentialsFile := cfg.GetGitCredentialsFile(packagePath); credentialsFile != "" {
+		// The credentials of the proxy are only used on behalf of authenticated clients, whatever the visibility
+		// of the module, as they may give access to any repository the rewrite rules map module paths to.
+		if !p.Config.authenticate(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="modproxy"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if username, password, err = readCredentials(credentialsFile); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			target := *origin
+			target.Path = strings.TrimSuffix(origin.Path, "/") + servicePath
+			target.RawPath = ""
+			target.RawQuery = pr.In.URL.RawQuery
+			pr.Out.URL = &target
+			pr.Out.Host = ""
+
+			// Never pass on the client's credentials, only those of the proxy.
+			pr.Out.Header.Del("Authorization")
+			if username != "" || password != "" {
+				pr.Out.SetBasicAuth(username, password)
+			}
+			otel.GetTextMapPropagator().Inject(pr.Out.Context(), propagation.HeaderCarrier(pr.Out.Header))
+		},
+		Transport: p.Transport,
+		ModifyResponse: func(resp *http.Response) error {
+			// Answering 401 would make the git client prompt for credentials the proxy ignores.
+			if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+				return errOriginCredentials
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger := p.Logger
+			if logger == nil {
+				logger = slog.Default()
+			}
+			logger.ErrorContext(r.Context(), "proxying git", slog.String("module", packagePath), slog.Any("error", err))
+			http.Error(w, fmt.Sprintf("Bad gateway: fetching the origin of %s failed", packagePath), http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
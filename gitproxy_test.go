@@ -0,0 +1,171 @@
+package modproxy
+
+import (
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestGitBackend serves the repositories below root over git smart HTTP using git http-backend,
+// requiring the basic auth credentials user and token.
+func newTestGitBackend(t *testing.T, root string) string {
+	out, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Skip("git not found")
+	}
+	backend := filepath.Join(strings.TrimSpace(string(out)), "git-http-backend")
+	if _, err := os.Stat(backend); err != nil {
+		t.Skip("git http-backend not found")
+	}
+
+	cgiHandler := &cgi.Handler{
+		Path: backend,
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1", "GIT_CONFIG_NOSYSTEM=1"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, token, ok := r.BasicAuth(); !ok || user != "user" || token != "token" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		cgiHandler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// newTestGitProxy serves go.loafoe.dev/fixture through the git proxy, from a private git smart-HTTP backend
+// accessed with the credentials in credentials. The returned proxy URL holds the credentials of a client.
+func newTestGitProxy(t *testing.T, credentials string) (*Config, string) {
+	root := t.TempDir()
+	runGit(t, root, "clone", "--quiet", "--bare", newTestRepository(t), "fixture.git")
+	backendURL := newTestGitBackend(t, root)
+
+	credentialsFile := filepath.Join(t.TempDir(), "credentials")
+	writeFile(t, filepath.Dir(credentialsFile), "credentials", credentials+"\n")
+
+	cfg := &Config{
+		HostPattern: "go.loafoe.dev",
+		PathDepth:   1,
+		GitProxy:    true,
+		AuthTokens:  []string{"secret"},
+		Visibility:  VisibilityPublic,
+		Rules: []Rule{{
+			Module:          "go.loafoe.dev/fixture",
+			Repository:      backendURL + "/fixture.git",
+			CredentialsFile: credentialsFile,
+		}},
+	}
+	srv := httptest.NewServer(NewHandler(cfg))
+	t.Cleanup(srv.Close)
+	return cfg, strings.Replace(srv.URL, "://", "://client:secret@", 1)
+}
+
+func TestGitProxyClone(t *testing.T) {
+	_, proxyURL := newTestGitProxy(t, "user:token")
+
+	dir := t.TempDir()
+	runGit(t, dir, "clone", "--quiet", proxyURL+GitPathPrefix+"/go.loafoe.dev/fixture", "fixture")
+	if _, err := os.Stat(filepath.Join(dir, "fixture", "v2", "go.mod")); err != nil {
+		t.Errorf("git clone through GitProxy did not check out the repository: %v", err)
+	}
+}
+
+func TestGitProxy(t *testing.T) {
+	_, proxyURL := newTestGitProxy(t, "user:token")
+
+	testCases := []struct {
+		name         string
+		method       string
+		path         string
+		expectedCode int
+	}{
+		{"Info refs", http.MethodGet, "/go.loafoe.dev/fixture/info/refs?service=git-upload-pack", http.StatusOK},
+		{"Push", http.MethodGet, "/go.loafoe.dev/fixture/info/refs?service=git-receive-pack", http.StatusForbidden},
+		{"Receive pack", http.MethodPost, "/go.loafoe.dev/fixture/git-receive-pack", http.StatusNotFound},
+		{"Subpackage", http.MethodGet, "/go.loafoe.dev/fixture/sub/info/refs?service=git-upload-pack", http.StatusNotFound},
+		{"Unknown host", http.MethodGet, "/example.org/fixture/info/refs?service=git-upload-pack", http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, proxyURL+GitPathPrefix+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.expectedCode {
+				t.Errorf("GitProxy got code %v, want %v", resp.StatusCode, tc.expectedCode)
+			}
+		})
+	}
+}
+
+func TestGitProxyRequiresAuthentication(t *testing.T) {
+	_, proxyURL := newTestGitProxy(t, "user:token")
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.User = nil
+
+	// The module is public, but the credentials of the proxy are never used for anonymous clients.
+	resp, err := http.Get(u.String() + GitPathPrefix + "/go.loafoe.dev/fixture/info/refs?service=git-upload-pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GitProxy got code %v for anonymous client, want %v", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestGitProxyRejectedCredentials(t *testing.T) {
+	_, proxyURL := newTestGitProxy(t, "user:expired")
+
+	resp, err := http.Get(proxyURL + GitPathPrefix + "/go.loafoe.dev/fixture/info/refs?service=git-upload-pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || resp.Header.Get("WWW-Authenticate") != "" {
+		t.Errorf("GitProxy got code %v and WWW-Authenticate %q, want %v without challenge",
+			resp.StatusCode, resp.Header.Get("WWW-Authenticate"), http.StatusBadGateway)
+	}
+}
+
+func TestGitProxyGoImport(t *testing.T) {
+	cfg, _ := newTestGitProxy(t, "user:token")
+
+	req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/fixture/sub?go-get=1", nil)
+	w := httptest.NewRecorder()
+	NewHandler(cfg).ServeHTTP(w, req)
+
+	gotMetaContent, _ := extractMetaTagAttribute(w.Body.String(), "go-import", "content")
+	if want := "go.loafoe.dev/fixture git https://go.loafoe.dev/.modproxy/git/go.loafoe.dev/fixture"; gotMetaContent != want {
+		t.Errorf("ModProxy got meta content %v, want %v", gotMetaContent, want)
+	}
+}
+
+func TestReadCredentials(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "basic", "x-access-token:secret\n")
+	writeFile(t, dir, "token", "secret\n")
+
+	if user, password, err := readCredentials(filepath.Join(dir, "basic")); err != nil || user != "x-access-token" || password != "secret" {
+		t.Errorf("readCredentials() = %q, %q, %v, want x-access-token, secret", user, password, err)
+	}
+	if user, password, err := readCredentials(filepath.Join(dir, "token")); err != nil || user != "" || password != "secret" {
+		t.Errorf("readCredentials() = %q, %q, %v, want empty user, secret", user, password, err)
+	}
+}
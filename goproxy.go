@@ -0,0 +1,450 @@
+package modproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/mod/zip"
+)
+
+// ErrModuleNotFound is returned when a module or one of its versions cannot be served.
+var ErrModuleNotFound = errors.New("not found")
+
+// errOrigin is returned when the repository of a module cannot be cloned or updated.
+var errOrigin = errors.New("fetching origin")
+
+// IsModuleProxyPath reports whether a request path belongs to the GOPROXY protocol,
+// i.e. /<module>/@v/<file> or /<module>/@latest.
+func IsModuleProxyPath(p string) bool {
+	return strings.Contains(p, "/@v/") || strings.HasSuffix(p, "/@latest")
+}
+
+// parseModuleProxyPath splits a GOPROXY protocol request path into the module path and the requested file,
+// which is "@latest" for /<module>/@latest requests.
+func parseModuleProxyPath(p string) (modulePath, file string, err error) {
+	escaped, file, found := strings.Cut(strings.TrimPrefix(p, "/"), "/@v/")
+	if !found {
+		escaped, found = strings.CutSuffix(strings.TrimPrefix(p, "/"), "/@latest")
+		if !found {
+			return "", "", fmt.Errorf("%w: %s", ErrModuleNotFound, p)
+		}
+		file = "@latest"
+	}
+
+	modulePath, err = module.UnescapePath(escaped)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrModuleNotFound, err)
+	}
+	return modulePath, file, nil
+}
+
+// revInfo is the JSON response of the .info and @latest endpoints.
+type revInfo struct {
+	Version string
+	Time    time.Time
+}
+
+// moduleSource serves the versions of a module from a local checkout of its repository.
+type moduleSource struct {
+	path      string // module path
+	pathMajor string // major version suffix of the module path, e.g. /v2
+	dir       string // directory of the module within the repository, excluding any major version subdirectory
+	repo      *gitRepo
+}
+
+// tagPrefix returns the prefix of the version tags of a module in the given directory of its repository.
+func tagPrefix(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return dir + "/"
+}
+
+// tagPrefix returns the prefix of the version tags of the module.
+func (m *moduleSource) tagPrefix() string {
+	return tagPrefix(m.dir)
+}
+
+// isModuleVersion reports whether v is a canonical semantic version matching the major version suffix pathMajor.
+func isModuleVersion(v, pathMajor string) bool {
+	return semver.IsValid(v) && semver.Canonical(v) == v && module.CheckPathMajor(v, pathMajor) == nil
+}
+
+// moduleVersions returns the versions of the tags with the given prefix that match the major version
+// suffix pathMajor, in ascending order.
+func moduleVersions(tags []string, prefix, pathMajor string) []string {
+	var versions []string
+	for _, tag := range tags {
+		if v, found := strings.CutPrefix(tag, prefix); found && isModuleVersion(v, pathMajor) {
+			versions = append(versions, v)
+		}
+	}
+	semver.Sort(versions)
+	return versions
+}
+
+// latestVersion returns the highest release version of a sorted list of versions, or the highest
+// pre-release version if there are no releases. Returns an empty string for an empty list.
+func latestVersion(versions []string) string {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if semver.Prerelease(versions[i]) == "" {
+			return versions[i]
+		}
+	}
+	if len(versions) == 0 {
+		return ""
+	}
+	return versions[len(versions)-1]
+}
+
+// isVersion reports whether v is a canonical semantic version matching the major version of the module.
+func (m *moduleSource) isVersion(v string) bool {
+	return isModuleVersion(v, m.pathMajor)
+}
+
+// versions returns the tagged versions of the module in ascending order.
+func (m *moduleSource) versions(ctx context.Context) ([]string, error) {
+	tags, err := m.repo.tags(ctx, m.tagPrefix()+"v")
+	if err != nil {
+		return nil, err
+	}
+	return moduleVersions(tags, m.tagPrefix(), m.pathMajor), nil
+}
+
+// tag returns the tag of a version of the module.
+func (m *moduleSource) tag(ctx context.Context, version string) (string, error) {
+	tag := m.tagPrefix() + version
+	if !m.isVersion(version) || !m.repo.hasTag(ctx, tag) {
+		return "", fmt.Errorf("%w: %s@%s: unknown revision %s", ErrModuleNotFound, m.path, version, version)
+	}
+	return tag, nil
+}
+
+// info returns the version and commit time of a version of the module.
+func (m *moduleSource) info(ctx context.Context, version string) (*revInfo, error) {
+	tag, err := m.tag(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	t, err := m.repo.commitTime(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &revInfo{Version: version, Time: t.UTC()}, nil
+}
+
+// latest returns the info of the highest release version of the module, or the highest
+// pre-release version if there are no releases.
+func (m *moduleSource) latest(ctx context.Context) (*revInfo, error) {
+	versions, err := m.versions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s: no tagged versions", ErrModuleNotFound, m.path)
+	}
+
+	return m.info(ctx, latestVersion(versions))
+}
+
+// moduleDir returns the directory holding the go.mod file of the module at a tag. Modules with a major
+// version suffix live either in a major version subdirectory or in the module directory itself.
+func (m *moduleSource) moduleDir(ctx context.Context, tag string) string {
+	if strings.HasPrefix(m.pathMajor, "/") {
+		subdir := path.Join(m.dir, m.pathMajor[1:])
+		if m.repo.hasFile(ctx, tag, path.Join(subdir, "go.mod")) {
+			return subdir
+		}
+	}
+	return m.dir
+}
+
+// goMod returns the go.mod file of a version of the module, synthesizing one if the module has none.
+func (m *moduleSource) goMod(ctx context.Context, version string) ([]byte, error) {
+	tag, err := m.tag(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	goModPath := path.Join(m.moduleDir(ctx, tag), "go.mod")
+	if !m.repo.hasFile(ctx, tag, goModPath) {
+		return []byte(fmt.Sprintf("module %s\n", modfile.AutoQuote(m.path))), nil
+	}
+	return m.repo.readFile(ctx, tag, goModPath)
+}
+
+// zip writes the module zip file of a version of the module to buf.
+func (m *moduleSource) zip(ctx context.Context, buf *bytes.Buffer, version string) error {
+	tag, err := m.tag(ctx, version)
+	if err != nil {
+		return err
+	}
+	return zip.CreateFromVCS(buf, module.Version{Path: m.path, Version: version}, m.repo.dir, tag, m.moduleDir(ctx, tag))
+}
+
+// maxRepos bounds the number of repositories a ModuleServer keeps track of, as any module path routed by the
+// configuration resolves to a repository.
+const maxRepos = 1000
+
+// ModuleServer serves the GOPROXY protocol for modules routed by the configuration, building
+// module versions from local checkouts of their git repositories.
+type ModuleServer struct {
+	Config      *Config
+	URLGetter   RequestURLGetter
+	PathGetter  PackagePathGetter
+	URLRewriter URLRewriter
+	// Logger logs the errors of the origin. If nil, slog.Default() is used.
+	Logger *slog.Logger
+
+	mu    sync.Mutex
+	repos map[string]*gitRepo
+}
+
+// NewModuleServer creates a new ModuleServer with the provided configuration and dependencies.
+func NewModuleServer(cfg *Config, urlGetter RequestURLGetter, pathGetter PackagePathGetter, urlRewriter URLRewriter) *ModuleServer {
+	return &ModuleServer{
+		Config:      cfg,
+		URLGetter:   urlGetter,
+		PathGetter:  pathGetter,
+		URLRewriter: urlRewriter,
+		repos:       make(map[string]*gitRepo),
+	}
+}
+
+// repo returns the local checkout of the repository at repoURL. At most maxRepos repositories are kept track of.
+func (s *ModuleServer) repo(repoURL string) *gitRepo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, ok := s.repos[repoURL]
+	if !ok {
+		if len(s.repos) >= maxRepos {
+			s.evictRepos()
+		}
+		repo = newGitRepo(s.Config.CacheDir, repoURL)
+		s.repos[repoURL] = repo
+	}
+	return repo
+}
+
+// evictRepos forgets the repositories whose last clone or fetch failed, or else one that isn't in use.
+// Checkouts stay on disk, so a repository requested again is fetched rather than cloned. Repositories that
+// are in use are never evicted, as their checkouts are being updated. The caller must hold s.mu.
+func (s *ModuleServer) evictRepos() {
+	var idle string
+	for repoURL, repo := range s.repos {
+		if !repo.mu.TryLock() {
+			continue
+		}
+		failed := repo.lastErr != nil
+		repo.mu.Unlock()
+
+		if failed {
+			delete(s.repos, repoURL)
+		} else if idle == "" {
+			idle = repoURL
+		}
+	}
+	if len(s.repos) >= maxRepos && idle != "" {
+		delete(s.repos, idle)
+	}
+}
+
+// resolveGitRepository resolves an import path to the configuration of its host, its module root and the URL of
+// its git repository the same way ModProxy resolves go-import requests, as if the import path was requested with
+// the given scheme. Import paths not routed by the configuration or not served from git yield ErrModuleNotFound.
+func resolveGitRepository(root *Config, pathGetter PackagePathGetter, urlRewriter URLRewriter, scheme, importPath string) (cfg *Config, packagePath, repoURL string, err error) {
+	host, _, _ := strings.Cut(importPath, "/")
+	cfg, ok := root.ForHost(host)
+	if !ok || !root.RoutesModule(importPath) {
+		return nil, "", "", fmt.Errorf("%w: %s: unknown host", ErrModuleNotFound, importPath)
+	}
+
+	importURL := scheme + "://" + importPath
+	packagePath, err = pathGetter.GetPackagePath(importURL, cfg)
+	if errors.Is(err, ErrNoRewriteRule) {
+		return nil, "", "", fmt.Errorf("%w: %v", ErrModuleNotFound, err)
+	}
+	if err != nil {
+		return nil, "", "", err
+	}
+	if cfg.KnownModulesOnly && !cfg.IsKnownModule(packagePath) {
+		return nil, "", "", fmt.Errorf("%w: module %s is not known to this proxy", ErrModuleNotFound, importPath)
+	}
+	if vcs := cfg.GetVCS(packagePath); vcs != "git" {
+		return nil, "", "", fmt.Errorf("%w: %s: serving %s repositories is not supported", ErrModuleNotFound, importPath, vcs)
+	}
+
+	repoURL, err = urlRewriter.RewriteURL(importURL, cfg)
+	if errors.Is(err, ErrNoRewriteRule) {
+		return nil, "", "", fmt.Errorf("%w: %v", ErrModuleNotFound, err)
+	}
+	if err != nil {
+		return nil, "", "", err
+	}
+	return cfg, packagePath, repoURL, nil
+}
+
+// moduleDirectory returns the directory of a module within the repository of its module root packagePath,
+// along with the major version suffix of the module path. The module lives in the directory corresponding
+// to the rest of its path, not counting any major version suffix.
+func moduleDirectory(modulePath, packagePath string) (dir, pathMajor string, err error) {
+	pathPrefix, pathMajor, _ := module.SplitPathVersion(modulePath)
+	if strings.HasPrefix(pathMajor, "/") {
+		packagePath = strings.TrimSuffix(packagePath, pathMajor)
+	}
+	if pathPrefix != packagePath && !strings.HasPrefix(pathPrefix, packagePath+"/") {
+		return "", "", fmt.Errorf("%w: %s: module path outside of repository %s", ErrModuleNotFound, modulePath, packagePath)
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(pathPrefix, packagePath), "/"), pathMajor, nil
+}
+
+// source resolves a module path to its repository the same way ModProxy resolves go-import requests,
+// as if the module path was requested with the given scheme, and updates the local checkout of the repository.
+func (s *ModuleServer) source(ctx context.Context, scheme, modulePath string) (*moduleSource, error) {
+	if err := module.CheckPath(modulePath); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrModuleNotFound, err)
+	}
+
+	_, packagePath, repoURL, err := resolveGitRepository(s.Config, s.PathGetter, s.URLRewriter, scheme, modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, pathMajor, err := moduleDirectory(modulePath, packagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := s.repo(repoURL)
+	if err := repo.sync(ctx, DefaultRefreshInterval); err != nil {
+		return nil, fmt.Errorf("%w: %v", errOrigin, err)
+	}
+
+	return &moduleSource{
+		path:      modulePath,
+		pathMajor: pathMajor,
+		dir:       dir,
+		repo:      repo,
+	}, nil
+}
+
+// logger returns the logger of the server, or the default logger if not set.
+func (s *ModuleServer) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+// writeError writes the HTTP error response for an error serving a module.
+// Not found errors are answered with 404 so the go command can fall back to the next proxy.
+// Other errors are logged rather than answered in detail, as they may reveal the origin and its output.
+func (s *ModuleServer) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrModuleNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errOrigin):
+		s.logger().ErrorContext(r.Context(), "fetching origin", slog.String("path", r.URL.Path), slog.Any("error", err))
+		http.Error(w, "Bad gateway: fetching the origin of the module failed", http.StatusBadGateway)
+	default:
+		s.logger().ErrorContext(r.Context(), "serving module", slog.String("path", r.URL.Path), slog.Any("error", err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// ServeHTTP serves the /@v/list, /@v/<version>.info, /@v/<version>.mod, /@v/<version>.zip and /@latest endpoints.
+func (s *ModuleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	modulePath, file, err := parseModuleProxyPath(r.URL.Path)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	requestURL, err := url.Parse(s.URLGetter.GetRequestURL(r))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	src, err := s.source(ctx, requestURL.Scheme, modulePath)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if file == "list" {
+		versions, err := src.versions(ctx)
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, v := range versions {
+			fmt.Fprintln(w, v)
+		}
+		return
+	}
+
+	if file == "@latest" {
+		info, err := src.latest(ctx)
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+		return
+	}
+
+	ext := path.Ext(file)
+	version, err := module.UnescapeVersion(strings.TrimSuffix(file, ext))
+	if err != nil {
+		s.writeError(w, r, fmt.Errorf("%w: %v", ErrModuleNotFound, err))
+		return
+	}
+
+	switch ext {
+	case ".info":
+		info, err := src.info(ctx, version)
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	case ".mod":
+		data, err := src.goMod(ctx, version)
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(data)
+	case ".zip":
+		// Build the zip in memory, so failures can still be answered with an error status.
+		var buf bytes.Buffer
+		if err := src.zip(ctx, &buf, version); err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(buf.Bytes())
+	default:
+		s.writeError(w, r, fmt.Errorf("%w: %s", ErrModuleNotFound, r.URL.Path))
+	}
+}
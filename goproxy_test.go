@@ -0,0 +1,322 @@
+package modproxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runGit runs a git command in dir with a fixed identity, failing the test on error.
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=modproxy", "GIT_AUTHOR_EMAIL=modproxy@example.org",
+		"GIT_COMMITTER_NAME=modproxy", "GIT_COMMITTER_EMAIL=modproxy@example.org",
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+}
+
+// writeFile writes a file below dir, creating any parent directories.
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestRepository creates a git repository holding go.loafoe.dev/fixture with versions v1.0.0, v1.0.1 and
+// v1.1.0-rc.1, and go.loafoe.dev/fixture/v2 in a major version subdirectory with version v2.0.0.
+func newTestRepository(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--quiet")
+
+	writeFile(t, dir, "go.mod", "module go.loafoe.dev/fixture\n\ngo 1.21\n")
+	writeFile(t, dir, "fixture.go", "package fixture\n")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "--quiet", "-m", "Initial commit")
+	runGit(t, dir, "tag", "v1.0.0")
+
+	writeFile(t, dir, "doc.go", "// Package fixture is a test fixture.\npackage fixture\n")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "--quiet", "-m", "Add documentation")
+	runGit(t, dir, "tag", "v1.0.1")
+
+	writeFile(t, dir, "v2/go.mod", "module go.loafoe.dev/fixture/v2\n\ngo 1.21\n")
+	writeFile(t, dir, "v2/fixture.go", "package fixture\n")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "--quiet", "-m", "Add v2")
+	runGit(t, dir, "tag", "v1.1.0-rc.1")
+	runGit(t, dir, "tag", "v2.0.0")
+
+	return dir
+}
+
+// Test case struct
+type ModuleServerTestCase struct {
+	name         string
+	path         string
+	expectedCode int
+	expectedBody string // Optional expected response body
+	expectedInfo string // Optional expected version in a JSON info response
+}
+
+// Test cases
+var moduleServerTestCases = []ModuleServerTestCase{
+	{
+		name:         "List versions",
+		path:         "/go.loafoe.dev/fixture/@v/list",
+		expectedCode: http.StatusOK,
+		expectedBody: "v1.0.0\nv1.0.1\nv1.1.0-rc.1\n",
+	},
+	{
+		name:         "List versions of major version subdirectory",
+		path:         "/go.loafoe.dev/fixture/v2/@v/list",
+		expectedCode: http.StatusOK,
+		expectedBody: "v2.0.0\n",
+	},
+	{
+		name:         "Version info",
+		path:         "/go.loafoe.dev/fixture/@v/v1.0.0.info",
+		expectedCode: http.StatusOK,
+		expectedInfo: "v1.0.0",
+	},
+	{
+		name:         "Latest skips pre-releases",
+		path:         "/go.loafoe.dev/fixture/@latest",
+		expectedCode: http.StatusOK,
+		expectedInfo: "v1.0.1",
+	},
+	{
+		name:         "go.mod file",
+		path:         "/go.loafoe.dev/fixture/@v/v1.0.0.mod",
+		expectedCode: http.StatusOK,
+		expectedBody: "module go.loafoe.dev/fixture\n\ngo 1.21\n",
+	},
+	{
+		name:         "go.mod file of major version subdirectory",
+		path:         "/go.loafoe.dev/fixture/v2/@v/v2.0.0.mod",
+		expectedCode: http.StatusOK,
+		expectedBody: "module go.loafoe.dev/fixture/v2\n\ngo 1.21\n",
+	},
+	{
+		name:         "Unknown version",
+		path:         "/go.loafoe.dev/fixture/@v/v1.2.0.info",
+		expectedCode: http.StatusNotFound,
+	},
+	{
+		name:         "Version of other major version",
+		path:         "/go.loafoe.dev/fixture/@v/v2.0.0.info",
+		expectedCode: http.StatusNotFound,
+	},
+	{
+		name:         "Non-canonical version",
+		path:         "/go.loafoe.dev/fixture/@v/v1.0.info",
+		expectedCode: http.StatusNotFound,
+	},
+	{
+		name:         "Unknown file",
+		path:         "/go.loafoe.dev/fixture/@v/v1.0.0.tar",
+		expectedCode: http.StatusNotFound,
+	},
+	{
+		name:         "Invalid module path",
+		path:         "/go.loafoe.dev/Fixture/@v/list",
+		expectedCode: http.StatusNotFound,
+	},
+	{
+		name:         "Unknown repository",
+		path:         "/go.loafoe.dev/missing/@v/list",
+		expectedCode: http.StatusBadGateway,
+	},
+}
+
+// newTestModuleServer creates a ModuleServer serving go.loafoe.dev/fixture from the repository in dir.
+// Other modules resolve to repositories that don't exist.
+func newTestModuleServer(t *testing.T, dir string) *ModuleServer {
+	cfg := &Config{
+		HostPattern:     "go.loafoe.dev",
+		HostReplacement: filepath.Dir(dir),
+		PathPattern:     "/",
+		PathReplacement: "/missing-",
+		PathDepth:       1,
+		CacheDir:        t.TempDir(),
+		Rules:           []Rule{{Module: "go.loafoe.dev/fixture", Repository: "file://" + dir}},
+	}
+	return NewModuleServer(cfg, DefaultRequestURLGetter{}, DefaultPackagePathGetter{}, DefaultURLRewriter{})
+}
+
+func TestModuleServer(t *testing.T) {
+	server := newTestModuleServer(t, newTestRepository(t))
+
+	for _, tc := range moduleServerTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev"+tc.path, nil)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedCode {
+				t.Fatalf("ModuleServer got code %v, want %v: %s", w.Code, tc.expectedCode, w.Body.String())
+			}
+			if tc.expectedBody != "" && w.Body.String() != tc.expectedBody {
+				t.Errorf("ModuleServer got body %q, want %q", w.Body.String(), tc.expectedBody)
+			}
+			if tc.expectedInfo != "" {
+				var info revInfo
+				if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+					t.Fatalf("ModuleServer got invalid info %q: %v", w.Body.String(), err)
+				}
+				if info.Version != tc.expectedInfo || info.Time.IsZero() {
+					t.Errorf("ModuleServer got info %+v, want version %v", info, tc.expectedInfo)
+				}
+			}
+		})
+	}
+}
+
+func TestModuleServerZip(t *testing.T) {
+	server := newTestModuleServer(t, newTestRepository(t))
+
+	req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/go.loafoe.dev/fixture/v2/@v/v2.0.0.zip", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("ModuleServer got code %v, want %v: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("ModuleServer got invalid zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	want := []string{"go.loafoe.dev/fixture/v2@v2.0.0/fixture.go", "go.loafoe.dev/fixture/v2@v2.0.0/go.mod"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("ModuleServer got zip files %v, want %v", names, want)
+	}
+}
+
+func TestNewHandlerServeModules(t *testing.T) {
+	dir := newTestRepository(t)
+	cfg := newTestModuleServer(t, dir).Config
+	cfg.ServeModules = true
+	handler := NewHandler(cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/go.loafoe.dev/fixture/@v/list", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "v1.0.0") {
+		t.Errorf("NewHandler() got code %v and body %q for version list", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/fixture?go-get=1", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, _ := extractMetaTagAttribute(w.Body.String(), "go-import", "content"); got != "go.loafoe.dev/fixture git file://"+dir {
+		t.Errorf("NewHandler() got go-import content %q", got)
+	}
+}
+
+func TestModuleServerOriginError(t *testing.T) {
+	server := newTestModuleServer(t, newTestRepository(t))
+	var logs bytes.Buffer
+	server.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/go.loafoe.dev/missing/@v/list", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("ModuleServer got code %v, want %v", w.Code, http.StatusBadGateway)
+	}
+	for _, detail := range []string{"missing-missing", "git"} {
+		if strings.Contains(w.Body.String(), detail) {
+			t.Errorf("ModuleServer got body %q, want it not to reveal %q", w.Body.String(), detail)
+		}
+	}
+	if !strings.Contains(logs.String(), "missing-missing") {
+		t.Errorf("ModuleServer logged %q, want the origin error", logs.String())
+	}
+}
+
+func TestGitRepoSyncCachesFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "repo")
+	repo := newGitRepo(t.TempDir(), "file://"+dir)
+	if err := repo.sync(context.Background(), time.Hour); err == nil {
+		t.Fatal("sync() error = nil, want error for missing repository")
+	}
+
+	// The failure is returned without asking the origin again until the refresh interval has passed.
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "init", "--quiet")
+	if err := repo.sync(context.Background(), time.Hour); err == nil {
+		t.Error("sync() error = nil, want cached error")
+	}
+	repo.failedAt = time.Time{}
+	if err := repo.sync(context.Background(), time.Hour); err != nil {
+		t.Errorf("sync() error = %v after refresh interval", err)
+	}
+}
+
+func TestGitRepoSyncDoesNotCacheCancellation(t *testing.T) {
+	dir := newTestRepository(t)
+	repo := newGitRepo(t.TempDir(), "file://"+dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := repo.sync(ctx, time.Hour); err == nil {
+		t.Fatal("sync() error = nil, want error for cancelled context")
+	}
+	if err := repo.sync(context.Background(), time.Hour); err != nil {
+		t.Errorf("sync() error = %v after a cancelled sync, want nil", err)
+	}
+}
+
+func TestModuleServerEvictsRepos(t *testing.T) {
+	server := newTestModuleServer(t, newTestRepository(t))
+	for i := 0; i < maxRepos; i++ {
+		repo := server.repo(fmt.Sprintf("https://example.org/repo-%d", i))
+		if i%2 == 0 {
+			repo.lastErr = errOrigin
+		}
+	}
+
+	server.repo("https://example.org/new")
+	if got, want := len(server.repos), maxRepos/2+1; got != want {
+		t.Errorf("ModuleServer kept %d repositories, want %d", got, want)
+	}
+	for i := 0; i < maxRepos; i++ {
+		server.repo(fmt.Sprintf("https://example.org/other-%d", i))
+	}
+	if len(server.repos) > maxRepos {
+		t.Errorf("ModuleServer kept %d repositories, want at most %d", len(server.repos), maxRepos)
+	}
+}
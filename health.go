@@ -0,0 +1,176 @@
+package modproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Paths of the health, readiness and build info endpoints.
+const (
+	HealthzPath = "/healthz"
+	ReadyzPath  = "/readyz"
+	VersionPath = "/version"
+)
+
+// modulePath is the path of this module, whose version is reported by the build info endpoint.
+const modulePath = "go.loafoe.dev/modproxy"
+
+// readinessTimeout bounds the time spent checking that the origins are reachable.
+const readinessTimeout = 5 * time.Second
+
+// buildInfo is the response of the build info endpoint.
+type buildInfo struct {
+	Version      string `json:"version"`
+	Revision     string `json:"revision,omitempty"`
+	Time         string `json:"time,omitempty"`
+	Modified     bool   `json:"modified,omitempty"`
+	GoVersion    string `json:"goVersion"`
+	Rules        int    `json:"rules"`
+	RewriteRules int    `json:"rewriteRules"`
+}
+
+// readBuildInfo returns the version of this module and the VCS revision it was built from, if known, along
+// with the number of rules and rewrite rules of the configuration and all of its virtual hosts.
+func readBuildInfo(cfg *Config) buildInfo {
+	info := buildInfo{Version: "(devel)"}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.GoVersion = bi.GoVersion
+		if bi.Main.Path == modulePath {
+			info.Version = bi.Main.Version
+		}
+		for _, dep := range bi.Deps {
+			if dep.Path == modulePath {
+				info.Version = dep.Version
+			}
+		}
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Revision = setting.Value
+			case "vcs.time":
+				info.Time = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	info.Rules, info.RewriteRules = len(cfg.Rules), len(cfg.RewriteRules)
+	for _, hostCfg := range cfg.Hosts {
+		if hostCfg != nil {
+			info.Rules += len(hostCfg.Rules)
+			info.RewriteRules += len(hostCfg.RewriteRules)
+		}
+	}
+	return info
+}
+
+// origins returns the distinct origins modules are rewritten to by the pattern and replacement values
+// of the configuration and all of its virtual hosts, e.g. https://github.com.
+func (cfg *Config) origins() []string {
+	seen := make(map[string]bool)
+	add := func(c *Config) {
+		if c != nil && c.HostReplacement != "" {
+			seen[c.SchemeReplacement+"://"+c.HostReplacement] = true
+		}
+	}
+
+	add(cfg)
+	for _, hostCfg := range cfg.Hosts {
+		add(hostCfg)
+	}
+	origins := make([]string, 0, len(seen))
+	for origin := range seen {
+		origins = append(origins, origin)
+	}
+	sort.Strings(origins)
+	return origins
+}
+
+// checkOrigin reports an error if the origin cannot be reached. Any HTTP response counts as reachable.
+func checkOrigin(ctx context.Context, client *http.Client, origin string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, origin+"/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// checkReady reports configErr, the error validating the configuration, if any, or else an error if, with
+// ServeModules set, one of the origins modules are built from cannot be reached.
+func checkReady(ctx context.Context, cfg *Config, configErr error, client *http.Client) error {
+	if configErr != nil {
+		return fmt.Errorf("invalid configuration: %w", configErr)
+	}
+	if !cfg.ServeModules {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, origin := range cfg.origins() {
+		if err := checkOrigin(ctx, client, origin); err != nil {
+			errs = append(errs, fmt.Errorf("origin %s unreachable: %w", origin, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isHealthPath reports whether a URL path is served by the health, readiness or build info endpoints.
+func isHealthPath(p string) bool {
+	return p == HealthzPath || p == ReadyzPath || p == VersionPath
+}
+
+// NewHealthHandler wraps a handler so that the health, readiness and build info endpoints are served without
+// authentication, logging or resolving the path as a module:
+//   - HealthzPath answers 200 OK as long as the process serves requests.
+//   - ReadyzPath answers 200 OK if the configuration is valid and, with ServeModules set, the origins of
+//     the pattern and replacement values can be reached, else 503 Service Unavailable.
+//   - VersionPath answers the module version, VCS revision and number of loaded rules as JSON.
+//
+// The endpoints take precedence over modules of the same name. The configuration is validated once, when the
+// handler is created, as validating stores the compiled rewrite rules that requests read.
+func NewHealthHandler(cfg *Config, next http.Handler) http.Handler {
+	configErr := cfg.Validate()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isHealthPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		switch r.URL.Path {
+		case HealthzPath:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprintln(w, "ok")
+		case ReadyzPath:
+			if err := checkReady(r.Context(), cfg, configErr, http.DefaultClient); err != nil {
+				http.Error(w, strings.ReplaceAll(err.Error(), "\n", "; "), http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprintln(w, "ok")
+		case VersionPath:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(readBuildInfo(cfg))
+		}
+	})
+}
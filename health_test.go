@@ -0,0 +1,162 @@
+package modproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type HealthTestCase struct {
+	name         string
+	cfg          *Config
+	path         string
+	expectedCode int
+	expectedBody string
+}
+
+// newOriginConfig returns a configuration serving modules rewritten to the origin at originURL.
+func newOriginConfig(t *testing.T, originURL string) *Config {
+	u, err := url.Parse(originURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Config{
+		HostPattern:       "go.loafoe.dev",
+		SchemeReplacement: u.Scheme,
+		HostReplacement:   u.Host,
+		PathPattern:       "/",
+		PathReplacement:   "/",
+		PathDepth:         1,
+		ServeModules:      true,
+		AuthTokens:        []string{"secret"},
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	origin := httptest.NewServer(http.NotFoundHandler())
+	defer origin.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []HealthTestCase{
+		{
+			name:         "Liveness",
+			cfg:          newOriginConfig(t, down.URL),
+			path:         HealthzPath,
+			expectedCode: http.StatusOK,
+			expectedBody: "ok\n",
+		},
+		{
+			name:         "Ready with reachable origin",
+			cfg:          newOriginConfig(t, origin.URL),
+			path:         ReadyzPath,
+			expectedCode: http.StatusOK,
+			expectedBody: "ok\n",
+		},
+		{
+			name:         "Not ready with unreachable origin",
+			cfg:          newOriginConfig(t, down.URL),
+			path:         ReadyzPath,
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: "unreachable",
+		},
+		{
+			name: "Ready without serving modules",
+			cfg: func() *Config {
+				cfg := newOriginConfig(t, down.URL)
+				cfg.ServeModules = false
+				return cfg
+			}(),
+			path:         ReadyzPath,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "Not ready with invalid configuration",
+			cfg: func() *Config {
+				cfg := newOriginConfig(t, origin.URL)
+				cfg.RewriteMode = "bogus"
+				return cfg
+			}(),
+			path:         ReadyzPath,
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: "invalid configuration",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev"+tc.path, nil)
+			w := httptest.NewRecorder()
+			NewHandler(tc.cfg).ServeHTTP(w, req)
+
+			if w.Code != tc.expectedCode {
+				t.Errorf("%s got code %v, want %v: %s", tc.path, w.Code, tc.expectedCode, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tc.expectedBody) {
+				t.Errorf("%s got body %q, want it to contain %q", tc.path, w.Body.String(), tc.expectedBody)
+			}
+			if strings.Contains(w.Body.String(), "go-import") {
+				t.Errorf("%s was resolved as a module", tc.path)
+			}
+		})
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	cfg := &Config{
+		HostPattern: "go.loafoe.dev",
+		Rules:       []Rule{{Module: "go.loafoe.dev/legacy", Repository: "https://hg.example.org/legacy"}},
+		Hosts: map[string]*Config{
+			"go.example.org": {
+				RewriteRules: []RewriteRule{{Match: `^go\.example\.org/(.+)`, Replace: "https://github.com/example/${1}"}},
+				Rules:        []Rule{{Module: "go.example.org/tool", Repository: "https://github.com/example/tool"}},
+			},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	NewHandler(cfg).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/version", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("version got code %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var info buildInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("version got %q, want JSON: %v", w.Body.String(), err)
+	}
+	if info.Version == "" || info.GoVersion == "" {
+		t.Errorf("version got %+v, want version and Go version", info)
+	}
+	if info.Rules != 2 || info.RewriteRules != 1 {
+		t.Errorf("version got %d rules and %d rewrite rules, want 2 and 1", info.Rules, info.RewriteRules)
+	}
+}
+
+func TestReadyzConcurrentRequests(t *testing.T) {
+	cfg := &Config{
+		HostPattern:  "go.loafoe.dev",
+		PathDepth:    1,
+		RewriteMode:  RewriteModeRegexp,
+		RewriteRules: []RewriteRule{{Match: `^go\.loafoe\.dev/(.+)`, Replace: "https://github.com/loafoe-dev/go-${1}"}},
+	}
+	handler := NewHandler(cfg)
+
+	// Probes don't write to the configuration requests read from, see go test -race.
+	var wg sync.WaitGroup
+	for _, path := range []string{ReadyzPath, "/modproxy?go-get=1", ReadyzPath, "/bitfield?go-get=1"} {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev"+path, nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("%s got code %v, want %v: %s", path, w.Code, http.StatusOK, w.Body.String())
+			}
+		}(path)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,165 @@
+package modproxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMetricsPath is the path at which NewHandler serves metrics.
+const DefaultMetricsPath = "/metrics"
+
+// maxModuleLabels bounds the number of import prefixes resolutions are counted for, as clients can make up
+// any number of them. Resolutions of further modules not listed in Modules or mapped by a rule are counted
+// as otherModules.
+const maxModuleLabels = 500
+
+// otherModules labels the resolutions of modules beyond maxModuleLabels.
+const otherModules = "other"
+
+// latencyBuckets are the upper bounds in seconds of the buckets of the ModProxy latency histogram.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics counts the requests served by modproxy and exposes them in the Prometheus text format.
+type Metrics struct {
+	mu sync.Mutex
+	// modules and rules count the requests ModProxy resolved, per import prefix and matched rule.
+	modules map[string]uint64
+	rules   map[string]uint64
+	// responses counts the responses of all requests per status class, e.g. 4xx.
+	responses map[string]uint64
+	// clients counts the requests served by ModProxy per client, go-get or browser.
+	clients map[string]uint64
+	// latencyCounts holds the cumulative counts of the latency histogram, per bucket of latencyBuckets.
+	latencyCounts []uint64
+	latencySum    float64
+	latencyCount  uint64
+}
+
+// NewMetrics creates a new Metrics with all counters at zero.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		modules:       make(map[string]uint64),
+		rules:         make(map[string]uint64),
+		responses:     make(map[string]uint64),
+		clients:       make(map[string]uint64),
+		latencyCounts: make([]uint64, len(latencyBuckets)),
+	}
+}
+
+// validateMetricsPath checks that a metrics path is an absolute URL path. An empty value is allowed.
+func validateMetricsPath(p string) error {
+	if p != "" && (!strings.HasPrefix(p, "/") || p == "/") {
+		return fmt.Errorf("metrics path %q must be an absolute path below the root", p)
+	}
+	return nil
+}
+
+// observeResponse counts a response, and the resolution of the request if ModProxy resolved it.
+func (m *Metrics) observeResponse(status int, res *resolution) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.responses[strconv.Itoa(status/100)+"xx"]++
+	if res.importPrefix != "" {
+		module := res.importPrefix
+		if _, ok := m.modules[module]; !ok && !res.known && len(m.modules) >= maxModuleLabels {
+			module = otherModules
+		}
+		m.modules[module]++
+		m.rules[res.rule]++
+	}
+}
+
+// observeModProxy counts a request served by ModProxy and its latency.
+func (m *Metrics) observeModProxy(goGet bool, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	client := "browser"
+	if goGet {
+		client = "go-get"
+	}
+	m.clients[client]++
+
+	seconds := latency.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			m.latencyCounts[i]++
+		}
+	}
+	m.latencySum += seconds
+	m.latencyCount++
+}
+
+// NewMetricsHandler wraps a handler so that the responses of all requests, and the resolutions of those
+// resolved by ModProxy, are counted in metrics.
+func NewMetricsHandler(metrics *Metrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, res := withResolution(r)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		metrics.observeResponse(rec.statusCode(), res)
+	})
+}
+
+// newModProxyMetricsHandler wraps the ModProxy handler so that its requests are counted per client
+// and their latency is observed in metrics.
+func newModProxyMetricsHandler(metrics *Metrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		metrics.observeModProxy(r.URL.Query().Get("go-get") == "1", time.Since(start))
+	})
+}
+
+// labelEscaper escapes label values in the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeCounter writes a counter with one label in the Prometheus text format, ordered by label value.
+func writeCounter(w io.Writer, name, help, label string, values map[string]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, label, labelEscaper.Replace(key), values[key])
+	}
+}
+
+// write writes the metrics in the Prometheus text format.
+func (m *Metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeCounter(w, "modproxy_module_resolutions_total", "Requests resolved to a module, per import prefix.", "module", m.modules)
+	writeCounter(w, "modproxy_rule_resolutions_total", "Requests resolved to a module, per matched rule.", "rule", m.rules)
+	writeCounter(w, "modproxy_responses_total", "Responses to all requests, per status class.", "code", m.responses)
+	writeCounter(w, "modproxy_requests_total", "Requests served by ModProxy, per client.", "client", m.clients)
+
+	const name = "modproxy_request_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Latency of the requests served by ModProxy.\n# TYPE %s histogram\n", name, name)
+	for i, bound := range latencyBuckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), m.latencyCounts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, m.latencyCount)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(m.latencySum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, m.latencyCount)
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
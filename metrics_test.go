@@ -0,0 +1,95 @@
+package modproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	cfg := &Config{
+		HostPattern:     "go.loafoe.dev",
+		HostReplacement: "github.com",
+		PathPattern:     "/",
+		PathReplacement: "/loafoe-dev/go-",
+		PathDepth:       1,
+		MetricsPath:     DefaultMetricsPath,
+		Rules:           []Rule{{Module: "go.loafoe.dev/legacy", Repository: "https://hg.example.org/legacy", VCS: "hg"}},
+	}
+	handler := NewHandler(cfg)
+
+	for _, target := range []string{
+		"https://go.loafoe.dev/modproxy?go-get=1",
+		"https://go.loafoe.dev/modproxy/cmd?go-get=1",
+		"https://go.loafoe.dev/legacy",
+		"https://go.loafoe.dev/favicon.ico",
+		"https://go.loafoe.dev/%22bogus%22?go-get=1",
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("metrics got code %v, want %v", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("metrics got Content-Type %q, want the Prometheus text format", got)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`modproxy_module_resolutions_total{module="go.loafoe.dev/modproxy"} 2`,
+		`modproxy_module_resolutions_total{module="go.loafoe.dev/legacy"} 1`,
+		`modproxy_rule_resolutions_total{rule="default"} 2`,
+		`modproxy_rule_resolutions_total{rule="go.loafoe.dev/legacy"} 1`,
+		`modproxy_responses_total{code="2xx"} 3`,
+		`modproxy_responses_total{code="4xx"} 2`,
+		`modproxy_requests_total{client="browser"} 2`,
+		`modproxy_requests_total{client="go-get"} 3`,
+		`modproxy_request_duration_seconds_bucket{le="+Inf"} 5`,
+		`modproxy_request_duration_seconds_count 5`,
+		"# TYPE modproxy_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics lack %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsLabelEscaping(t *testing.T) {
+	m := NewMetrics()
+	m.observeResponse(http.StatusOK, &resolution{importPrefix: "go.loafoe.dev/x", rule: `^go\.loafoe\.dev/"x"`})
+
+	var b strings.Builder
+	m.write(&b)
+	if want := `modproxy_rule_resolutions_total{rule="^go\\.loafoe\\.dev/\"x\""} 1`; !strings.Contains(b.String(), want) {
+		t.Errorf("metrics lack %q, got:\n%s", want, b.String())
+	}
+}
+
+func TestMetricsModuleLabelBound(t *testing.T) {
+	m := NewMetrics()
+	for i := 0; i < maxModuleLabels+10; i++ {
+		m.observeResponse(http.StatusOK, &resolution{importPrefix: fmt.Sprintf("go.loafoe.dev/made-up-%d", i), rule: defaultRuleName})
+	}
+	m.observeResponse(http.StatusOK, &resolution{importPrefix: "go.loafoe.dev/made-up-0", rule: defaultRuleName})
+	m.observeResponse(http.StatusOK, &resolution{importPrefix: "go.loafoe.dev/modproxy", rule: defaultRuleName, known: true})
+
+	var b strings.Builder
+	m.write(&b)
+	for _, want := range []string{
+		`modproxy_module_resolutions_total{module="go.loafoe.dev/made-up-0"} 2`,
+		`modproxy_module_resolutions_total{module="go.loafoe.dev/modproxy"} 1`,
+		`modproxy_module_resolutions_total{module="other"} 10`,
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+	if strings.Contains(b.String(), fmt.Sprintf(`module="go.loafoe.dev/made-up-%d"`, maxModuleLabels)) {
+		t.Errorf("metrics label more than %d modules", maxModuleLabels)
+	}
+}
@@ -0,0 +1,211 @@
+package modproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// mirrorScheme returns the scheme module paths are resolved with when mirroring, so that the scheme
+// replacement of the configuration applies just as for requests.
+func mirrorScheme(cfg *Config) string {
+	if cfg.SchemePattern == "" {
+		return "https"
+	}
+	return cfg.SchemePattern
+}
+
+// majorVersionPaths returns the module paths of the major versions tagged in the repository of a module,
+// e.g. go.loafoe.dev/mod and go.loafoe.dev/mod/v2. A module path that has a major version suffix
+// already is returned as is.
+func (m *moduleSource) majorVersionPaths(ctx context.Context) ([]string, error) {
+	if m.pathMajor != "" {
+		return []string{m.path}, nil
+	}
+
+	tags, err := m.repo.tags(ctx, m.tagPrefix()+"v")
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{m.path}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		v := strings.TrimPrefix(tag, m.tagPrefix())
+		if !semver.IsValid(v) || semver.Canonical(v) != v {
+			continue
+		}
+		if major := semver.Major(v); major != "v0" && major != "v1" && !seen[major] {
+			seen[major] = true
+			paths = append(paths, m.path+"/"+major)
+		}
+	}
+	return paths, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to name and renames it into place,
+// so an interrupted mirror never leaves a partial file behind.
+func writeFileAtomic(name string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// readVersionList returns the versions listed in an existing list file, or nil if there is none.
+func readVersionList(name string) ([]string, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// mirrorVersion writes the .info, .mod and .zip files of a version of the module to versionDir.
+// The zip file is written last, marking the version as complete.
+func (m *moduleSource) mirrorVersion(ctx context.Context, versionDir, version string) error {
+	escaped, err := module.EscapeVersion(version)
+	if err != nil {
+		return err
+	}
+	base := filepath.Join(versionDir, escaped)
+
+	info, err := m.info(ctx, version)
+	if err != nil {
+		return err
+	}
+	infoData, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(base+".info", infoData); err != nil {
+		return err
+	}
+
+	goMod, err := m.goMod(ctx, version)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(base+".mod", goMod); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := m.zip(ctx, &buf, version); err != nil {
+		return err
+	}
+	return writeFileAtomic(base+".zip", buf.Bytes())
+}
+
+// mirrorModule writes the versions of the module that are missing from dir, and updates its list file.
+// It returns the versions added.
+func (m *moduleSource) mirrorModule(ctx context.Context, dir string) ([]module.Version, error) {
+	escaped, err := module.EscapePath(m.path)
+	if err != nil {
+		return nil, err
+	}
+	versionDir := filepath.Join(dir, filepath.FromSlash(escaped), "@v")
+	if err := os.MkdirAll(versionDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	listFile := filepath.Join(versionDir, "list")
+	versions, err := readVersionList(listFile)
+	if err != nil {
+		return nil, err
+	}
+	mirrored := make(map[string]bool)
+	for _, v := range versions {
+		mirrored[v] = true
+	}
+
+	tagged, err := m.versions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var added []module.Version
+	for _, v := range tagged {
+		if mirrored[v] {
+			continue
+		}
+		if err := m.mirrorVersion(ctx, versionDir, v); err != nil {
+			return added, fmt.Errorf("%s@%s: %w", m.path, v, err)
+		}
+		mirrored[v] = true
+		versions = append(versions, v)
+		added = append(added, module.Version{Path: m.path, Version: v})
+	}
+
+	// Versions are kept in the list even if their tag was removed since, as their files remain.
+	semver.Sort(versions)
+	var list strings.Builder
+	for _, v := range versions {
+		list.WriteString(v + "\n")
+	}
+	return added, writeFileAtomic(listFile, []byte(list.String()))
+}
+
+// Mirror writes every tagged version of the modules known to the configuration, including their
+// major versions, to dir in the GOPROXY directory layout, so that dir can be used as GOPROXY=file:///dir.
+// Versions already present in dir are skipped, and so are modules that cannot be served, such as those in
+// repositories of another VCS than git. It returns the versions added.
+func (s *ModuleServer) Mirror(ctx context.Context, dir string) ([]module.Version, error) {
+	scheme := mirrorScheme(s.Config)
+
+	var added []module.Version
+	for _, modulePath := range s.Config.KnownModules() {
+		src, err := s.source(ctx, scheme, modulePath)
+		if errors.Is(err, ErrModuleNotFound) {
+			s.logger().WarnContext(ctx, "skipping module", slog.String("module", modulePath), slog.Any("error", err))
+			continue
+		}
+		if err != nil {
+			return added, fmt.Errorf("%s: %w", modulePath, err)
+		}
+		paths, err := src.majorVersionPaths(ctx)
+		if err != nil {
+			return added, fmt.Errorf("%s: %w", modulePath, err)
+		}
+
+		for _, p := range paths {
+			if p != modulePath {
+				if src, err = s.source(ctx, scheme, p); err != nil {
+					return added, fmt.Errorf("%s: %w", p, err)
+				}
+			}
+			versions, err := src.mirrorModule(ctx, dir)
+			added = append(added, versions...)
+			if err != nil {
+				return added, err
+			}
+		}
+	}
+	return added, nil
+}
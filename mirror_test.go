@@ -0,0 +1,56 @@
+package modproxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMirror(t *testing.T) {
+	repoDir := newTestRepository(t)
+	server := newTestModuleServer(t, repoDir)
+	server.Config.Modules = []string{"go.loafoe.dev/fixture"}
+	// Modules in repositories of another VCS are skipped, and the others mirrored nevertheless.
+	server.Config.Rules = append([]Rule{{Module: "go.loafoe.dev/legacy", Repository: "https://hg.example.org/legacy", VCS: "hg"}}, server.Config.Rules...)
+	dir := t.TempDir()
+
+	added, err := server.Mirror(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("Mirror() error = %v", err)
+	}
+	if len(added) != 4 {
+		t.Errorf("Mirror() added %v, want 4 versions", added)
+	}
+
+	for _, name := range []string{
+		"go.loafoe.dev/fixture/@v/v1.0.0.info",
+		"go.loafoe.dev/fixture/@v/v1.0.0.mod",
+		"go.loafoe.dev/fixture/@v/v1.0.0.zip",
+		"go.loafoe.dev/fixture/@v/v1.1.0-rc.1.zip",
+		"go.loafoe.dev/fixture/v2/@v/v2.0.0.zip",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Mirror() did not write %s: %v", name, err)
+		}
+	}
+	list, err := os.ReadFile(filepath.Join(dir, "go.loafoe.dev/fixture/@v/list"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "v1.0.0\nv1.0.1\nv1.1.0-rc.1\n"; string(list) != want {
+		t.Errorf("Mirror() wrote list %q, want %q", list, want)
+	}
+
+	// A re-run only adds versions tagged since, after the checkout is refreshed.
+	runGit(t, repoDir, "tag", "v1.2.0")
+	server.repo("file://" + repoDir).lastFetch = time.Time{}
+	added, err = server.Mirror(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("Mirror() error = %v", err)
+	}
+	if len(added) != 1 || added[0].Version != "v1.2.0" {
+		t.Errorf("Mirror() re-run added %v, want v1.2.0", added)
+	}
+}
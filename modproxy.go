@@ -1,10 +1,18 @@
 package modproxy
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"html/template"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
 
-	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/mod/module"
 )
 
 // Interfaces
@@ -13,7 +21,7 @@ type RequestURLGetter interface {
 }
 
 type PackagePathGetter interface {
-	GetPackagePath(url string) (string, error)
+	GetPackagePath(url string, cfg *Config) (string, error)
 }
 
 type URLRewriter interface {
@@ -21,26 +29,46 @@ type URLRewriter interface {
 }
 
 // Concrete implementations
-type DefaultRequestURLGetter struct{}
+
+// DefaultRequestURLGetter constructs the request URL with GetRequestURL, or with GetForwardedRequestURL
+// if trusted proxies are set.
+type DefaultRequestURLGetter struct {
+	// TrustedProxies are the address ranges of the reverse proxies whose forwarding headers are honoured.
+	TrustedProxies []netip.Prefix
+}
+
 type DefaultPackagePathGetter struct{}
 type DefaultURLRewriter struct{}
+type RegexpURLRewriter struct{}
 
-func (DefaultRequestURLGetter) GetRequestURL(r *http.Request) string {
+func (g DefaultRequestURLGetter) GetRequestURL(r *http.Request) string {
+	if len(g.TrustedProxies) > 0 {
+		return GetForwardedRequestURL(r, g.TrustedProxies)
+	}
 	return GetRequestURL(r)
 }
 
-func (DefaultPackagePathGetter) GetPackagePath(url string) (string, error) {
-	return GetPackagePath(url)
+func (DefaultPackagePathGetter) GetPackagePath(url string, cfg *Config) (string, error) {
+	return GetPackagePath(url, cfg)
 }
 
+// RewriteURL rewrites using the rewrite mode of the configuration, which may differ per virtual host.
 func (DefaultURLRewriter) RewriteURL(originalURL string, cfg *Config) (string, error) {
+	if cfg.RewriteMode == RewriteModeRegexp {
+		return RewriteURLRegexp(originalURL, cfg)
+	}
 	return RewriteURL(originalURL, cfg)
 }
 
+func (RegexpURLRewriter) RewriteURL(originalURL string, cfg *Config) (string, error) {
+	return RewriteURLRegexp(originalURL, cfg)
+}
+
 // Compile-time check to ensure default implementations correctly implement interfaces
 var _ RequestURLGetter = &DefaultRequestURLGetter{}
 var _ PackagePathGetter = &DefaultPackagePathGetter{}
 var _ URLRewriter = &DefaultURLRewriter{}
+var _ URLRewriter = &RegexpURLRewriter{}
 
 // URLManipulator contains the dependencies for the ModProxy function.
 type URLManipulator struct {
@@ -50,52 +78,164 @@ type URLManipulator struct {
 	URLRewriter URLRewriter
 }
 
-// init registers the ModProxy function as an HTTP-triggered function using environment variables.
-func init() {
-	// Initialize configuration.
-	cfg := NewConfigFromEnvironment()
-
-	// Create default implementations for the interfaces
-	urlGetter := DefaultRequestURLGetter{}
-	pathGetter := DefaultPackagePathGetter{}
-	urlRewriter := DefaultURLRewriter{}
+// metaTagsTemplate renders the go-import meta tag, and the go-source meta tag if provided.
+// The content is escaped, as the package path is derived from the request.
+var metaTagsTemplate = template.Must(template.New("meta").Parse(
+	`<meta name="go-import" content="{{.GoImport}}">{{with .GoSource}}<meta name="go-source" content="{{.}}">{{end}}`))
 
-	// Register the ModProxy handler with the configuration.
-	functions.HTTP("ModProxy", NewModProxyHandler(cfg, urlGetter, pathGetter, urlRewriter))
+// generateMetaTags generates the go-import meta tag, and the go-source meta tag if provided.
+func generateMetaTags(packagePath, vcs, rewrittenURL, goSource string) (template.HTML, error) {
+	var buf bytes.Buffer
+	err := metaTagsTemplate.Execute(&buf, struct{ GoImport, GoSource string }{
+		GoImport: packagePath + " " + vcs + " " + rewrittenURL,
+		GoSource: goSource,
+	})
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
 }
 
-// generateMetaTags generates the HTML response with the go-import meta tag.
-func generateMetaTags(packagePath, rewrittenURL string) string {
-	return fmt.Sprintf(`<html><head><meta name="go-import" content="%s git %s"></head><body></body></html>`, packagePath, rewrittenURL)
+// validateImportPath checks the import path of a request, made up of the host name without port and the path,
+// against the rules of the go command for import paths.
+func validateImportPath(requestURL *url.URL) error {
+	return module.CheckImportPath(requestURL.Hostname() + strings.TrimSuffix(requestURL.Path, "/"))
 }
 
 // ModProxy is the main handler for the HTTP function.
 // It rewrites the requested URL based on the provided configuration.
+// The request is traced in a span, with child spans for each of the dependencies it calls.
 func ModProxy(cfg *Config, urlGetter RequestURLGetter, pathGetter PackagePathGetter, urlRewriter URLRewriter, w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "ModProxy")
+	defer span.End()
+	r = r.WithContext(ctx)
+
 	// Get the complete original request URL.
+	_, urlSpan := tracer.Start(ctx, "RequestURLGetter.GetRequestURL")
 	originalURL := urlGetter.GetRequestURL(r)
+	urlSpan.SetAttributes(attribute.String("url.full", originalURL))
+	urlSpan.End()
 
-	// Get the package path (host + path) from the request URL
-	packagePath, err := pathGetter.GetPackagePath(originalURL)
+	// Select the configuration of the requested virtual host.
+	parsedURL, err := url.Parse(originalURL)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// Authentication is only configured at the top level.
+	authCfg := cfg
+	cfg, ok := cfg.ForHost(parsedURL.Host)
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	// Serve the module catalogue at the root path, listing private modules to authenticated clients only.
+	if isIndexRequest(r, parsedURL.Path) {
+		showPrivate := !authCfg.AuthEnabled() || authCfg.authenticate(r)
+		serveIndex(w, r, cfg, parsedURL, pathGetter, urlRewriter, showPrivate)
+		return
+	}
+
+	// Answer requests that never belong to a module, such as robots.txt, without resolving them.
+	if serveReservedPath(w, parsedURL.Path) {
+		return
+	}
+
+	// Reject paths the go command would never request, such as those containing quotes or angle brackets.
+	// The path is not echoed back in the response.
+	if err := validateImportPath(parsedURL); err != nil {
+		http.Error(w, "Invalid import path", http.StatusBadRequest)
+		return
+	}
+
+	// Get the package path (host + module root) from the request URL
+	_, pathSpan := tracer.Start(ctx, "PackagePathGetter.GetPackagePath")
+	packagePath, err := pathGetter.GetPackagePath(originalURL, cfg)
+	pathSpan.SetAttributes(attribute.String("modproxy.import_prefix", packagePath))
+	endSpan(pathSpan, err)
+	if errors.Is(err, ErrNoRewriteRule) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		// Handle error, e.g., by sending an HTTP error response
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	// Reject modules that are not registered, so go get fails fast with a clear message.
+	if cfg.KnownModulesOnly && !cfg.IsKnownModule(packagePath) {
+		http.Error(w, fmt.Sprintf("module %s is not known to this proxy", packagePath), http.StatusNotFound)
+		return
+	}
+
 	// Rewrite the URL based on the patterns and replacements.
+	_, rewriteSpan := tracer.Start(ctx, "URLRewriter.RewriteURL")
 	rewrittenURL, err := urlRewriter.RewriteURL(originalURL, cfg)
+	rewriteSpan.SetAttributes(attribute.String("modproxy.repo_url", rewrittenURL))
+	endSpan(rewriteSpan, err)
+	if errors.Is(err, ErrNoRewriteRule) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rule := cfg.matchedRule(parsedURL)
+	recordResolution(ctx, packagePath, rewrittenURL, rule, cfg.IsKnownModule(packagePath))
+	span.SetAttributes(
+		attribute.String("modproxy.import_prefix", packagePath),
+		attribute.String("modproxy.repo_url", rewrittenURL),
+		attribute.String("modproxy.rule", rule),
+	)
+
+	// Build the go-source tag content for the configured forge.
+	goSource, err := GetGoSource(packagePath, rewrittenURL, cfg)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Generate the HTML response with meta tags
-	htmlResponse := generateMetaTags(packagePath, rewrittenURL)
+	// Point the go command at the git proxy, which holds the credentials of the repository.
+	vcs := cfg.GetVCS(packagePath)
+	repoURL := rewrittenURL
+	if cfg.GitProxy && vcs == "git" {
+		repoURL = GitProxyURL(parsedURL.Scheme, parsedURL.Host, packagePath)
+	}
+
+	// Redirect browsers, keeping the page with the meta tags in the body for tools that don't follow redirects.
+	goGet := r.URL.Query().Get("go-get") == "1"
+	importPath := parsedURL.Host + strings.TrimSuffix(parsedURL.Path, "/")
+	var location string
+	if !goGet {
+		location = GetBrowserRedirect(importPath, packagePath, rewrittenURL, cfg)
+	}
 
-	// Set the Content-Type header and write the HTML response
-	w.Header().Set("Content-Type", "text/html")
-	fmt.Fprintln(w, htmlResponse)
+	// Render the module page with the meta tags. The origin is only consulted for pages shown to browsers.
+	metaTags, err := generateMetaTags(packagePath, vcs, repoURL, goSource)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	page := newModulePage(r.Context(), cfg, metaTags, importPath, packagePath, rewrittenURL, !goGet && location == "")
+	body, err := executeTemplate(cfg, moduleTemplate, page)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Set the Content-Type header
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if location != "" {
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusFound)
+	}
+
+	// Write the HTML response
+	w.Write(body)
 }
 
 // NewModProxyHandler creates a new HTTP handler for ModProxy with the provided configuration and dependencies.
@@ -105,3 +245,69 @@ func NewModProxyHandler(cfg *Config, urlGetter RequestURLGetter, pathGetter Pack
 		ModProxy(cfg, urlGetter, pathGetter, urlRewriter, w, r)
 	}
 }
+
+// NewHandler creates an HTTP handler serving ModProxy with the provided configuration
+// and the default implementations of its dependencies. Requests below GitPathPrefix are served by a GitProxy.
+// If ServeModules is set, GOPROXY protocol requests are served by a ModuleServer, and if Upstream is set,
+// GOPROXY protocol requests for modules not routed by the configuration are forwarded to the upstream proxies.
+// Without ServeModules, GOPROXY protocol requests for routed modules are answered with 404 Not Found.
+// Requests for private modules require authentication if users or tokens are configured, see NewAuthHandler.
+// The forwarding headers of requests from TrustedProxies are honoured, see GetForwardedRequestURL.
+// Every request is logged to standard error in the configured LogFormat, see NewAccessLogHandler, and counted
+// in metrics served at MetricsPath, if set. Requests are traced with the global tracer provider, see SetupTracing.
+// Probes of the health, readiness and build info endpoints bypass all of the above, see NewHealthHandler.
+func NewHandler(cfg *Config) http.Handler {
+	// LoadConfig validates the trusted proxies, invalid entries are never trusted.
+	trustedProxies, _ := ParseTrustedProxies(cfg.TrustedProxies)
+	urlGetter := DefaultRequestURLGetter{TrustedProxies: trustedProxies}
+
+	logger := cfg.NewLogger(os.Stderr)
+	metrics := NewMetrics()
+	modProxy := newModProxyMetricsHandler(metrics, NewModProxyHandler(cfg, urlGetter, DefaultPackagePathGetter{}, DefaultURLRewriter{}))
+	gitProxy := NewGitProxy(cfg, urlGetter, DefaultPackagePathGetter{}, DefaultURLRewriter{})
+	gitProxy.Logger = logger
+
+	var upstream http.Handler
+	if cfg.Upstream != "" {
+		proxy, err := NewUpstreamProxy(cfg.Upstream)
+		if err != nil {
+			// LoadConfig validates the upstream list, so this only happens for configurations that weren't validated.
+			upstream = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			})
+		} else {
+			upstream = proxy
+		}
+	}
+
+	// Without ServeModules, GOPROXY protocol requests for routed modules are answered with 404, so the go command
+	// falls back to the next proxy in GOPROXY. They are never forwarded upstream, as they may be private.
+	var moduleServer http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Not found: modules are not served", http.StatusNotFound)
+	})
+	if cfg.ServeModules {
+		server := NewModuleServer(cfg, urlGetter, DefaultPackagePathGetter{}, DefaultURLRewriter{})
+		server.Logger = logger
+		moduleServer = server
+	}
+
+	handler := NewAuthHandler(cfg, urlGetter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case cfg.MetricsPath != "" && r.URL.Path == cfg.MetricsPath:
+			metrics.ServeHTTP(w, r)
+		case strings.HasPrefix(r.URL.Path, GitPathPrefix+"/"):
+			gitProxy.ServeHTTP(w, r)
+		case IsModuleProxyPath(r.URL.Path):
+			if upstream != nil {
+				if modulePath, _, err := parseModuleProxyPath(r.URL.Path); err == nil && !cfg.RoutesModule(modulePath) {
+					upstream.ServeHTTP(w, r)
+					return
+				}
+			}
+			moduleServer.ServeHTTP(w, r)
+		default:
+			modProxy.ServeHTTP(w, r)
+		}
+	}))
+	return NewHealthHandler(cfg, NewTracingHandler(NewAccessLogHandler(logger, urlGetter, NewMetricsHandler(metrics, handler))))
+}
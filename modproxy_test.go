@@ -13,19 +13,25 @@ import (
 
 // Test case structs
 type ModProxyTestCase struct {
-	name            string
-	config          *Config
-	mockURLGetter   RequestURLGetter  // Optional mock for RequestURLGetter
-	mockPathGetter  PackagePathGetter // Optional mock for PackagePathGetter
-	mockURLRewriter URLRewriter       // Optional mock for URLRewriter
-	module          string
-	expectedCode    int
-	expectedRewrite string
+	name             string
+	config           *Config
+	mockURLGetter    RequestURLGetter  // Optional mock for RequestURLGetter
+	mockPathGetter   PackagePathGetter // Optional mock for PackagePathGetter
+	mockURLRewriter  URLRewriter       // Optional mock for URLRewriter
+	host             string            // Optional request host, defaults to config.HostPattern
+	module           string
+	query            string // Optional query string, e.g. "?go-get=1"
+	expectedCode     int
+	expectedPrefix   string // Optional expected go-import prefix, defaults to GetPackagePath
+	expectedRewrite  string
+	expectedSource   string // Optional expected go-source content
+	expectedLocation string // Optional expected redirect location
+	expectedBody     string // Optional expected substring of the response body
 }
 
 // Mock implementations
 type mockPackagePathGetter struct {
-	mockFunc func(url string) (string, error)
+	mockFunc func(url string, cfg *Config) (string, error)
 }
 
 type mockURLRewriter struct {
@@ -36,8 +42,8 @@ type mockRequestURLGetter struct {
 	mockFunc func(r *http.Request) string
 }
 
-func (m mockPackagePathGetter) GetPackagePath(url string) (string, error) {
-	return m.mockFunc(url)
+func (m mockPackagePathGetter) GetPackagePath(url string, cfg *Config) (string, error) {
+	return m.mockFunc(url, cfg)
 }
 
 func (m mockURLRewriter) RewriteURL(originalURL string, cfg *Config) (string, error) {
@@ -67,6 +73,264 @@ var modProxyTestCases = []ModProxyTestCase{
 		expectedCode:    http.StatusOK,
 		expectedRewrite: "https://github.com/loafoe-dev/go-modproxy",
 	},
+	{
+		name: "Test subpackage of module",
+		config: &Config{
+			HostPattern:     "go.loafoe.dev",
+			HostReplacement: "github.com",
+			PathPattern:     "/",
+			PathReplacement: "/loafoe-dev/go-",
+			PathDepth:       1,
+		},
+		module:          "modproxy/internal/foo",
+		expectedCode:    http.StatusOK,
+		expectedPrefix:  "go.loafoe.dev/modproxy",
+		expectedRewrite: "https://github.com/loafoe-dev/go-modproxy",
+	},
+	{
+		name: "Test Mercurial module",
+		config: &Config{
+			HostPattern:     "go.loafoe.dev",
+			HostReplacement: "hg.example.com",
+			PathPattern:     "/",
+			PathReplacement: "/loafoe-dev/go-",
+			VCS:             "hg",
+		},
+		module:          "legacy",
+		expectedCode:    http.StatusOK,
+		expectedRewrite: "https://hg.example.com/loafoe-dev/go-legacy",
+	},
+	{
+		name: "Test explicitly mapped module",
+		config: &Config{
+			HostPattern:     "go.loafoe.dev",
+			HostReplacement: "github.com",
+			PathPattern:     "/",
+			PathReplacement: "/loafoe-dev/go-",
+			PathDepth:       1,
+			Rules: []Rule{
+				{Module: "go.loafoe.dev/tools/legacy", Repository: "https://hg.example.org/legacy", VCS: "hg"},
+			},
+		},
+		module:          "tools/legacy/cmd",
+		expectedCode:    http.StatusOK,
+		expectedPrefix:  "go.loafoe.dev/tools/legacy",
+		expectedRewrite: "https://hg.example.org/legacy",
+	},
+	{
+		name: "Test regexp rewrite rule",
+		config: &Config{
+			HostPattern:  "go.loafoe.dev",
+			PathPattern:  "/",
+			RewriteMode:  RewriteModeRegexp,
+			RewriteRules: []RewriteRule{{Match: `^go\.loafoe\.dev/x/([^/]+)`, Replace: "https://gitlab.com/loafoe/${1}-go"}},
+		},
+		module:          "x/foo/internal/bar",
+		expectedCode:    http.StatusOK,
+		expectedPrefix:  "go.loafoe.dev/x/foo",
+		expectedRewrite: "https://gitlab.com/loafoe/foo-go",
+	},
+	{
+		name: "Test regexp rewrite without matching rule",
+		config: &Config{
+			HostPattern:  "go.loafoe.dev",
+			PathPattern:  "/",
+			RewriteMode:  RewriteModeRegexp,
+			RewriteRules: []RewriteRule{{Match: `^go\.loafoe\.dev/x/([^/]+)`, Replace: "https://gitlab.com/loafoe/${1}-go"}},
+		},
+		mockURLRewriter: RegexpURLRewriter{},
+		module:          "favicon.ico",
+		expectedCode:    http.StatusNotFound,
+	},
+	{
+		name: "Test additional virtual host",
+		config: &Config{
+			HostPattern:     "go.loafoe.dev",
+			HostReplacement: "github.com",
+			PathPattern:     "/",
+			PathReplacement: "/loafoe-dev/go-",
+			PathDepth:       1,
+			Hosts: map[string]*Config{
+				"go.example.org": {
+					HostPattern:     "go.example.org",
+					HostReplacement: "gitlab.com",
+					PathPattern:     "/",
+					PathReplacement: "/example/",
+					PathDepth:       1,
+				},
+			},
+		},
+		host:            "go.example.org",
+		module:          "tool/cmd",
+		expectedCode:    http.StatusOK,
+		expectedPrefix:  "go.example.org/tool",
+		expectedRewrite: "https://gitlab.com/example/tool",
+	},
+	{
+		name: "Test primary host with virtual hosts",
+		config: &Config{
+			HostPattern:     "go.loafoe.dev",
+			HostReplacement: "github.com",
+			PathPattern:     "/",
+			PathReplacement: "/loafoe-dev/go-",
+			PathDepth:       1,
+			Hosts: map[string]*Config{
+				"go.example.org": {HostPattern: "go.example.org", HostReplacement: "gitlab.com", PathPattern: "/", PathReplacement: "/example/"},
+			},
+		},
+		module:          "modproxy",
+		expectedCode:    http.StatusOK,
+		expectedRewrite: "https://github.com/loafoe-dev/go-modproxy",
+	},
+	{
+		name: "Test unknown virtual host",
+		config: &Config{
+			HostPattern:     "go.loafoe.dev",
+			HostReplacement: "github.com",
+			PathPattern:     "/",
+			PathReplacement: "/loafoe-dev/go-",
+			Hosts: map[string]*Config{
+				"go.example.org": {HostPattern: "go.example.org", HostReplacement: "gitlab.com", PathPattern: "/", PathReplacement: "/example/"},
+			},
+		},
+		host:         "go.unknown.net",
+		module:       "modproxy",
+		expectedCode: http.StatusNotFound,
+	},
+	{
+		name: "Test browser redirect to pkg.go.dev",
+		config: &Config{
+			HostPattern:     "go.loafoe.dev",
+			HostReplacement: "github.com",
+			PathPattern:     "/",
+			PathReplacement: "/loafoe-dev/go-",
+			PathDepth:       1,
+			BrowserRedirect: BrowserRedirectPkgsite,
+		},
+		module:           "modproxy/internal/foo",
+		expectedCode:     http.StatusFound,
+		expectedPrefix:   "go.loafoe.dev/modproxy",
+		expectedRewrite:  "https://github.com/loafoe-dev/go-modproxy",
+		expectedLocation: "https://pkg.go.dev/go.loafoe.dev/modproxy/internal/foo",
+	},
+	{
+		name: "Test browser redirect to repository",
+		config: &Config{
+			HostPattern:     "go.loafoe.dev",
+			HostReplacement: "github.com",
+			PathPattern:     "/",
+			PathReplacement: "/loafoe-dev/go-",
+			BrowserRedirect: BrowserRedirectRepository,
+		},
+		module:           "modproxy",
+		expectedCode:     http.StatusFound,
+		expectedRewrite:  "https://github.com/loafoe-dev/go-modproxy",
+		expectedLocation: "https://github.com/loafoe-dev/go-modproxy",
+	},
+	{
+		name: "Test no browser redirect for go get",
+		config: &Config{
+			HostPattern:     "go.loafoe.dev",
+			HostReplacement: "github.com",
+			PathPattern:     "/",
+			PathReplacement: "/loafoe-dev/go-",
+			BrowserRedirect: BrowserRedirectPkgsite,
+		},
+		module:          "modproxy",
+		query:           "?go-get=1",
+		expectedCode:    http.StatusOK,
+		expectedPrefix:  "go.loafoe.dev/modproxy",
+		expectedRewrite: "https://github.com/loafoe-dev/go-modproxy",
+	},
+	{
+		name: "Test known module",
+		config: &Config{
+			HostPattern:      "go.loafoe.dev",
+			HostReplacement:  "github.com",
+			PathPattern:      "/",
+			PathReplacement:  "/loafoe-dev/go-",
+			PathDepth:        1,
+			KnownModulesOnly: true,
+			Modules:          []string{"go.loafoe.dev/modproxy"},
+		},
+		module:          "modproxy/internal/foo",
+		expectedCode:    http.StatusOK,
+		expectedPrefix:  "go.loafoe.dev/modproxy",
+		expectedRewrite: "https://github.com/loafoe-dev/go-modproxy",
+	},
+	{
+		name: "Test module known through rule",
+		config: &Config{
+			HostPattern:      "go.loafoe.dev",
+			HostReplacement:  "github.com",
+			PathPattern:      "/",
+			PathReplacement:  "/loafoe-dev/go-",
+			PathDepth:        1,
+			KnownModulesOnly: true,
+			Rules:            []Rule{{Module: "go.loafoe.dev/legacy", Repository: "https://hg.example.org/legacy"}},
+		},
+		module:          "legacy",
+		expectedCode:    http.StatusOK,
+		expectedRewrite: "https://hg.example.org/legacy",
+	},
+	{
+		name: "Test known module deeper than path depth",
+		config: &Config{
+			HostPattern:      "go.loafoe.dev",
+			HostReplacement:  "gitlab.com",
+			PathPattern:      "/",
+			PathReplacement:  "/loafoe/",
+			PathDepth:        1,
+			KnownModulesOnly: true,
+			Modules:          []string{"go.loafoe.dev/tools", "go.loafoe.dev/tools/cli"},
+		},
+		module:          "tools/cli/v2/cmd",
+		expectedCode:    http.StatusOK,
+		expectedPrefix:  "go.loafoe.dev/tools/cli",
+		expectedRewrite: "https://gitlab.com/loafoe/tools/cli",
+	},
+	{
+		name: "Test unknown module",
+		config: &Config{
+			HostPattern:      "go.loafoe.dev",
+			HostReplacement:  "github.com",
+			PathPattern:      "/",
+			PathReplacement:  "/loafoe-dev/go-",
+			PathDepth:        1,
+			KnownModulesOnly: true,
+			Modules:          []string{"go.loafoe.dev/modproxy"},
+		},
+		module:       "bogus",
+		expectedCode: http.StatusNotFound,
+		expectedBody: "module go.loafoe.dev/bogus is not known to this proxy",
+	},
+	{
+		name: "Test go-source tag",
+		config: &Config{
+			HostPattern:     "go.loafoe.dev",
+			HostReplacement: "github.com",
+			PathPattern:     "/",
+			PathReplacement: "/loafoe-dev/go-",
+			SourceForge:     ForgeGitHub,
+			SourceRef:       "main",
+		},
+		module:          "modproxy",
+		expectedCode:    http.StatusOK,
+		expectedRewrite: "https://github.com/loafoe-dev/go-modproxy",
+		expectedSource:  "go.loafoe.dev/modproxy https://github.com/loafoe-dev/go-modproxy https://github.com/loafoe-dev/go-modproxy/tree/main{/dir} https://github.com/loafoe-dev/go-modproxy/blob/main{/dir}/{file}#L{line}",
+	},
+	{
+		name: "Unsupported source forge",
+		config: &Config{
+			HostPattern:     "go.loafoe.dev",
+			HostReplacement: "github.com",
+			PathPattern:     "/",
+			PathReplacement: "/loafoe-dev/go-",
+			SourceForge:     "sourcehut",
+		},
+		module:       "modproxy",
+		expectedCode: http.StatusInternalServerError,
+	},
 	{
 		name: "Mock error with GetPackagePath",
 		config: &Config{
@@ -76,7 +340,7 @@ var modProxyTestCases = []ModProxyTestCase{
 			PathReplacement: "/loafoe-dev/go-",
 		},
 		mockPathGetter: &mockPackagePathGetter{
-			mockFunc: func(url string) (string, error) {
+			mockFunc: func(url string, cfg *Config) (string, error) {
 				return "", errors.New("mock error")
 			},
 		},
@@ -101,6 +365,103 @@ var modProxyTestCases = []ModProxyTestCase{
 	},
 }
 
+// Test cases for paths that never belong to a module
+var reservedPathTestCases = []struct {
+	name         string
+	path         string
+	expectedCode int
+	expectedBody string
+}{
+	{"Root path", "/", http.StatusOK, "<h1>go.loafoe.dev</h1>"},
+	{"Root path go get request", "/?go-get=1", http.StatusNotFound, "Not found"},
+	{"robots.txt", "/robots.txt", http.StatusOK, "Disallow: /"},
+	{"favicon.ico", "/favicon.ico", http.StatusNotFound, "Not found"},
+	{"Well-known path", "/.well-known/security.txt?go-get=1", http.StatusNotFound, "Not found"},
+}
+
+func TestModProxyReservedPaths(t *testing.T) {
+	cfg := &Config{
+		HostPattern:     "go.loafoe.dev",
+		HostReplacement: "github.com",
+		PathPattern:     "/",
+		PathReplacement: "/loafoe-dev/go-",
+		PathDepth:       1,
+	}
+	handler := NewModProxyHandler(cfg, DefaultRequestURLGetter{}, DefaultPackagePathGetter{}, DefaultURLRewriter{})
+
+	for _, tc := range reservedPathTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev"+tc.path, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedCode {
+				t.Errorf("ModProxy(%q) got code %v, want %v", tc.path, w.Code, tc.expectedCode)
+			}
+			if !strings.Contains(w.Body.String(), tc.expectedBody) {
+				t.Errorf("ModProxy(%q) got body %q, want body containing %q", tc.path, w.Body.String(), tc.expectedBody)
+			}
+			if _, found := extractMetaTagAttribute(w.Body.String(), "go-import", "content"); found {
+				t.Errorf("ModProxy(%q) got a go-import meta tag", tc.path)
+			}
+		})
+	}
+}
+
+// Test cases for request paths that are not valid import paths
+var invalidImportPathTestCases = []struct {
+	name string
+	path string
+}{
+	{"Quotes", `/mod"><script>alert(1)</script>`},
+	{"Angle brackets", "/mod<b>"},
+	{"Space", "/mod%20name"},
+	{"Backslash", `/mod\name`},
+}
+
+func TestModProxyInvalidImportPath(t *testing.T) {
+	cfg := &Config{
+		HostPattern:     "go.loafoe.dev",
+		HostReplacement: "github.com",
+		PathPattern:     "/",
+		PathReplacement: "/loafoe-dev/go-",
+		PathDepth:       0,
+	}
+	handler := NewModProxyHandler(cfg, DefaultRequestURLGetter{}, DefaultPackagePathGetter{}, DefaultURLRewriter{})
+
+	for _, tc := range invalidImportPathTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/", nil)
+			req.URL.Path = tc.path
+			req.URL.RawPath = ""
+			req.URL.RawQuery = "go-get=1"
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("ModProxy(%q) got code %v, want %v", tc.path, w.Code, http.StatusBadRequest)
+			}
+			if strings.Contains(w.Body.String(), "<script>") {
+				t.Errorf("ModProxy(%q) reflected the path unescaped: %q", tc.path, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGenerateMetaTagsEscapes(t *testing.T) {
+	metaTags, err := generateMetaTags(`go.loafoe.dev/"mod"`, "git", "https://github.com/loafoe-dev/go-<mod>", "")
+	if err != nil {
+		t.Fatalf("generateMetaTags() error = %v", err)
+	}
+	if strings.Contains(string(metaTags), `"mod"`) || strings.Contains(string(metaTags), "<mod>") {
+		t.Errorf("generateMetaTags() got unescaped content %q", metaTags)
+	}
+	got, _ := extractMetaTagAttribute(string(metaTags), "go-import", "content")
+	if want := `go.loafoe.dev/"mod" git https://github.com/loafoe-dev/go-<mod>`; got != want {
+		t.Errorf("generateMetaTags() got content %q, want %q", got, want)
+	}
+}
+
 // extractMetaTagAttribute is a helper function to extract the content of an attribute of a specified meta tag.
 func extractMetaTagAttribute(htmlContent, metaName, attrName string) (string, bool) {
 	// Parse the HTML content
@@ -160,7 +521,11 @@ func TestModProxy(t *testing.T) {
 			handler := NewModProxyHandler(tc.config, urlGetter, pathGetter, urlRewriter)
 
 			// Create an HTTP request to the handler
-			url := fmt.Sprintf("https://%s%s%s", tc.config.HostPattern, tc.config.PathPattern, tc.module)
+			host := tc.host
+			if host == "" {
+				host = tc.config.HostPattern
+			}
+			url := fmt.Sprintf("https://%s%s%s%s", host, tc.config.PathPattern, tc.module, tc.query)
 			req := httptest.NewRequest(http.MethodGet, url, nil)
 
 			// Record the HTTP response
@@ -174,11 +539,21 @@ func TestModProxy(t *testing.T) {
 				t.Errorf("ModProxy(%q):\n\tgot code %v\n\twant code %v", url, got, want)
 			}
 
+			// Check the response body, if a specific one is expected
+			if !strings.Contains(w.Body.String(), tc.expectedBody) {
+				t.Errorf("ModProxy(%q):\n\tgot body %q\n\twant body containing %q", url, w.Body.String(), tc.expectedBody)
+			}
+
 			// If an error is expected, don't proceed to check the content
 			if tc.expectedCode >= http.StatusBadRequest {
 				return
 			}
 
+			// Check the redirect location
+			if got, want := w.Header().Get("Location"), tc.expectedLocation; got != want {
+				t.Errorf("ModProxy(%q):\n\tgot location %q\n\twant location %q", url, got, want)
+			}
+
 			// Read the HTML response body
 			respBody := w.Body.String()
 
@@ -189,16 +564,58 @@ func TestModProxy(t *testing.T) {
 			}
 
 			// Expected meta tag content
-			packagePath, err := GetPackagePath(url)
-			if err != nil {
-				t.Fatalf("Error getting package path: %v", err)
+			packagePath := tc.expectedPrefix
+			if packagePath == "" {
+				var err error
+				packagePath, err = GetPackagePath(url, tc.config)
+				if err != nil {
+					t.Fatalf("Error getting package path: %v", err)
+				}
 			}
-			wantMetaContent := fmt.Sprintf("%s git %s", packagePath, tc.expectedRewrite)
+			wantMetaContent := fmt.Sprintf("%s %s %s", packagePath, tc.config.GetVCS(packagePath), tc.expectedRewrite)
 
 			// Check the go-import meta tag content
 			if !strings.Contains(gotMetaContent, wantMetaContent) {
 				t.Fatalf("ModProxy(%q):\n\tgot meta content %v\n\twant meta content %v", url, gotMetaContent, wantMetaContent)
 			}
+
+			// Check the go-source meta tag content, if one is expected
+			if tc.expectedSource == "" {
+				return
+			}
+			gotSourceContent, found := extractMetaTagAttribute(respBody, "go-source", "content")
+			if !found {
+				t.Fatalf("go-source meta tag not found")
+			}
+			if gotSourceContent != tc.expectedSource {
+				t.Fatalf("ModProxy(%q):\n\tgot go-source content %v\n\twant go-source content %v", url, gotSourceContent, tc.expectedSource)
+			}
 		})
 	}
 }
+
+func TestNewHandler(t *testing.T) {
+	cfg := &Config{
+		HostPattern:     "go.loafoe.dev",
+		HostReplacement: "github.com",
+		PathPattern:     "/",
+		PathReplacement: "/loafoe-dev/go-",
+		PathDepth:       1,
+	}
+	handler := NewHandler(cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/modproxy/cmd?go-get=1", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("NewHandler() got code %v, want %v", w.Code, http.StatusOK)
+	}
+	gotMetaContent, found := extractMetaTagAttribute(w.Body.String(), "go-import", "content")
+	if !found {
+		t.Fatalf("go-import meta tag not found")
+	}
+	if want := "go.loafoe.dev/modproxy git https://github.com/loafoe-dev/go-modproxy"; gotMetaContent != want {
+		t.Errorf("NewHandler() got meta content %v, want %v", gotMetaContent, want)
+	}
+}
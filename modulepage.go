@@ -0,0 +1,106 @@
+package modproxy
+
+import (
+	"context"
+	"html/template"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// majorVersion is a major version of a module listed on its page.
+type majorVersion struct {
+	Path    string // Module path of the major version, e.g. go.loafoe.dev/mod/v2.
+	Version string // Latest version.
+}
+
+// modulePage is the data the module template is rendered with.
+type modulePage struct {
+	MetaTags      template.HTML // The go-import and go-source meta tags.
+	ImportPath    string        // The requested import path.
+	Module        string        // The module root.
+	Repository    string
+	Description   string
+	Readme        string
+	MajorVersions []majorVersion // Only looked up for pages shown to browsers.
+}
+
+// catalogueEntry returns the catalogue entry of a module root, or nil if it is not in the catalogue.
+func (cfg *Config) catalogueEntry(packagePath string) *CatalogueEntry {
+	for i, entry := range cfg.Catalogue {
+		if entry.ImportPath == packagePath {
+			return &cfg.Catalogue[i]
+		}
+	}
+	return nil
+}
+
+// majorVersions returns the major versions tagged in the git repository at repoURL of the module rooted at
+// packagePath, along with their latest versions, in ascending order.
+func (c *tagCache) majorVersions(ctx context.Context, packagePath, repoURL string) []majorVersion {
+	ctx, cancel := context.WithTimeout(ctx, tagLookupTimeout)
+	defer cancel()
+
+	tags, err := c.tags(ctx, repoURL)
+	if err != nil {
+		return nil
+	}
+
+	base, _, _ := module.SplitPathVersion(packagePath)
+	var majors []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if !semver.IsValid(tag) || semver.Canonical(tag) != tag {
+			continue
+		}
+		major := semver.Major(tag)
+		if major == "v0" || major == "v1" {
+			major = ""
+		}
+		if !seen[major] {
+			seen[major] = true
+			majors = append(majors, major)
+		}
+	}
+
+	versions := make([]majorVersion, 0, len(majors))
+	for _, major := range majors {
+		pathMajor := ""
+		if major != "" {
+			pathMajor = "/" + major
+		}
+		version := latestVersion(moduleVersions(tags, "", pathMajor))
+		versions = append(versions, majorVersion{Path: base + pathMajor, Version: version})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return semver.Compare(versions[i].Version, versions[j].Version) < 0
+	})
+	return versions
+}
+
+// newModulePage builds the data of the page of a module. Major versions are only looked up if lookup is set,
+// so go get requests don't wait for the origin, and only for modules in the catalogue or known to the
+// configuration, so arbitrary request paths don't make the origin be asked for repositories that may not exist.
+func newModulePage(ctx context.Context, cfg *Config, metaTags template.HTML, importPath, packagePath, repoURL string, lookup bool) modulePage {
+	page := modulePage{
+		MetaTags:   metaTags,
+		ImportPath: importPath,
+		Module:     packagePath,
+		Repository: repoURL,
+	}
+	entry := cfg.catalogueEntry(packagePath)
+	if entry != nil {
+		page.Description = entry.Description
+		page.Readme = strings.TrimSpace(entry.Readme)
+		if entry.Repository != "" {
+			page.Repository = entry.Repository
+		}
+	}
+	known := entry != nil || cfg.IsKnownModule(packagePath)
+	if lookup && known && cfg.GetVCS(packagePath) == "git" {
+		page.MajorVersions = remoteTags.majorVersions(ctx, packagePath, repoURL)
+	}
+	return page
+}
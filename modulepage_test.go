@@ -0,0 +1,91 @@
+package modproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestModulePageConfig returns a configuration serving go.loafoe.dev/fixture from the repository in dir,
+// with a catalogue entry for it.
+func newTestModulePageConfig(dir string) *Config {
+	return &Config{
+		HostPattern: "go.loafoe.dev",
+		PathDepth:   1,
+		SourceForge: ForgeNone,
+		Rules:       []Rule{{Module: "go.loafoe.dev/fixture", Repository: "file://" + dir}},
+		Catalogue: []CatalogueEntry{{
+			ImportPath:  "go.loafoe.dev/fixture",
+			Description: "A test fixture",
+			Readme:      "# fixture\n\nUse <fixture> in tests.\n",
+		}},
+	}
+}
+
+func TestModulePage(t *testing.T) {
+	dir := newTestRepository(t)
+	handler := NewModProxyHandler(newTestModulePageConfig(dir), DefaultRequestURLGetter{}, DefaultPackagePathGetter{}, DefaultURLRewriter{})
+
+	req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/fixture/sub", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("ModProxy got code %v, want %v", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	if got, _ := extractMetaTagAttribute(body, "go-import", "content"); got != "go.loafoe.dev/fixture git file://"+dir {
+		t.Errorf("ModProxy got go-import content %q", got)
+	}
+	for _, want := range []string{
+		"<h1>go.loafoe.dev/fixture</h1>",
+		"<p>A test fixture</p>",
+		"go get go.loafoe.dev/fixture/sub",
+		`<a href="https://pkg.go.dev/go.loafoe.dev/fixture/sub">`,
+		"<code>go.loafoe.dev/fixture</code></a> v1.0.1",
+		"<code>go.loafoe.dev/fixture/v2</code></a> v2.0.0",
+		"Use &lt;fixture&gt; in tests.",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("ModProxy got body %q, want body containing %q", body, want)
+		}
+	}
+}
+
+func TestModulePageGoGet(t *testing.T) {
+	dir := newTestRepository(t)
+	handler := NewModProxyHandler(newTestModulePageConfig(dir), DefaultRequestURLGetter{}, DefaultPackagePathGetter{}, DefaultURLRewriter{})
+
+	req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/fixture?go-get=1", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	// go get requests don't wait for the major versions to be looked up.
+	if strings.Contains(w.Body.String(), "Major versions") {
+		t.Errorf("ModProxy looked up major versions for a go get request")
+	}
+}
+
+func TestModulePageTemplate(t *testing.T) {
+	templateDir := t.TempDir()
+	writeFile(t, templateDir, "module.html", `<html><head>{{.MetaTags}}</head><body>{{.Module}} by loafoe</body></html>`)
+
+	cfg := newTestModulePageConfig(t.TempDir())
+	cfg.TemplateDir = templateDir
+	if err := cfg.LoadTemplates(); err != nil {
+		t.Fatalf("LoadTemplates() error = %v", err)
+	}
+	handler := NewModProxyHandler(cfg, DefaultRequestURLGetter{}, DefaultPackagePathGetter{}, DefaultURLRewriter{})
+
+	req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/fixture?go-get=1", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if !strings.Contains(w.Body.String(), "<body>go.loafoe.dev/fixture by loafoe</body>") {
+		t.Errorf("ModProxy got body %q, want the custom module template", w.Body.String())
+	}
+	if _, found := extractMetaTagAttribute(w.Body.String(), "go-import", "content"); !found {
+		t.Errorf("ModProxy got no go-import meta tag with the custom module template")
+	}
+}
@@ -0,0 +1,43 @@
+package modproxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Browser redirect targets. Any other value is treated as a custom URL template.
+const (
+	BrowserRedirectNone       = "none"
+	BrowserRedirectPkgsite    = "pkgsite"
+	BrowserRedirectRepository = "repository"
+)
+
+// validateBrowserRedirect checks a browser redirect target. Empty values are allowed.
+func validateBrowserRedirect(target string) error {
+	switch target {
+	case "", BrowserRedirectNone, BrowserRedirectPkgsite, BrowserRedirectRepository:
+		return nil
+	}
+	if !strings.HasPrefix(target, "https://") && !strings.HasPrefix(target, "http://") {
+		return fmt.Errorf("unsupported browser redirect %q", target)
+	}
+	return nil
+}
+
+// GetBrowserRedirect returns the location to redirect browsers to for the requested import path,
+// or an empty string if browsers should not be redirected.
+// Custom templates may refer to {import} for the requested import path, {module} for the module root
+// and {repository} for the rewritten repository URL.
+func GetBrowserRedirect(importPath, packagePath, repoURL string, cfg *Config) string {
+	switch cfg.BrowserRedirect {
+	case "", BrowserRedirectNone:
+		return ""
+	case BrowserRedirectPkgsite:
+		return "https://pkg.go.dev/" + importPath
+	case BrowserRedirectRepository:
+		return repoURL
+	}
+
+	r := strings.NewReplacer("{import}", importPath, "{module}", packagePath, "{repository}", repoURL)
+	return r.Replace(cfg.BrowserRedirect)
+}
@@ -0,0 +1,50 @@
+package modproxy
+
+import "testing"
+
+// Test case struct
+type GetBrowserRedirectTestCase struct {
+	name             string
+	cfg              *Config
+	expectedLocation string
+}
+
+// Test cases
+var getBrowserRedirectTestCases = []GetBrowserRedirectTestCase{
+	{
+		name:             "No redirect configured",
+		cfg:              &Config{},
+		expectedLocation: "",
+	},
+	{
+		name:             "Redirect disabled",
+		cfg:              &Config{BrowserRedirect: BrowserRedirectNone},
+		expectedLocation: "",
+	},
+	{
+		name:             "Redirect to pkg.go.dev",
+		cfg:              &Config{BrowserRedirect: BrowserRedirectPkgsite},
+		expectedLocation: "https://pkg.go.dev/go.loafoe.dev/modproxy/internal/foo",
+	},
+	{
+		name:             "Redirect to repository",
+		cfg:              &Config{BrowserRedirect: BrowserRedirectRepository},
+		expectedLocation: "https://github.com/loafoe-dev/go-modproxy",
+	},
+	{
+		name:             "Redirect to custom template",
+		cfg:              &Config{BrowserRedirect: "https://docs.example.org/{module}?pkg={import}&src={repository}"},
+		expectedLocation: "https://docs.example.org/go.loafoe.dev/modproxy?pkg=go.loafoe.dev/modproxy/internal/foo&src=https://github.com/loafoe-dev/go-modproxy",
+	},
+}
+
+func TestGetBrowserRedirect(t *testing.T) {
+	for _, tc := range getBrowserRedirectTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			location := GetBrowserRedirect("go.loafoe.dev/modproxy/internal/foo", "go.loafoe.dev/modproxy", "https://github.com/loafoe-dev/go-modproxy", tc.cfg)
+			if location != tc.expectedLocation {
+				t.Errorf("GetBrowserRedirect() got %v, want %v", location, tc.expectedLocation)
+			}
+		})
+	}
+}
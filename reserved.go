@@ -0,0 +1,48 @@
+package modproxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// robotsTxt keeps crawlers away, as the pages of modproxy only hold meta tags.
+const robotsTxt = "User-agent: *\nDisallow: /\n"
+
+// notFoundPaths are paths requested by browsers and other tools that are never module paths.
+var notFoundPaths = map[string]bool{
+	"/favicon.ico":                      true,
+	"/apple-touch-icon.png":             true,
+	"/apple-touch-icon-precomposed.png": true,
+	"/sitemap.xml":                      true,
+	"/ads.txt":                          true,
+}
+
+// isReservedPath reports whether a URL path is handled by serveReservedPath rather than resolved to a module.
+func isReservedPath(p string) bool {
+	// Path elements starting with a dot, e.g. /.well-known, are not allowed in import paths.
+	return p == "" || p == "/" || p == "/robots.txt" || notFoundPaths[p] || strings.HasPrefix(p, "/.")
+}
+
+// isIndexRequest reports whether a request is for the index page at the root path, rather than a go get request.
+func isIndexRequest(r *http.Request, p string) bool {
+	return (p == "" || p == "/") && r.URL.Query().Get("go-get") != "1"
+}
+
+// serveReservedPath serves requests for robots.txt and other paths that never belong to a module, so they
+// don't produce go-import meta tags for bogus repositories. It reports whether the request was served.
+func serveReservedPath(w http.ResponseWriter, p string) bool {
+	if !isReservedPath(p) {
+		return false
+	}
+
+	if p == "/robots.txt" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, robotsTxt)
+		return true
+	}
+
+	// There is no module at the root, so go get requests for it are not found either.
+	http.Error(w, "Not found", http.StatusNotFound)
+	return true
+}
@@ -1,6 +1,7 @@
 package modproxy
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -24,43 +25,146 @@ func GetRequestURL(r *http.Request) string {
 	return fmt.Sprintf("%s://%s%s", scheme, host, r.URL.RequestURI())
 }
 
-func removeVersionSuffix(path string) string {
-	re := regexp.MustCompile(`/v(\d+)$`)
-	return re.ReplaceAllString(path, "")
+// ErrNoRewriteRule is returned when no rewrite rule matches the requested import path.
+var ErrNoRewriteRule = errors.New("no rewrite rule matches")
+
+// majorVersionRe matches a semantic import versioning major version path element, e.g. v2.
+var majorVersionRe = regexp.MustCompile(`^v([2-9]|[1-9][0-9]+)$`)
+
+// gopkgVersionRe matches a path element with a gopkg.in-style major version suffix, e.g. yaml.v3.
+var gopkgVersionRe = regexp.MustCompile(`^(.+)(\.v(0|[1-9][0-9]*))$`)
+
+// splitModulePath splits a URL path into the module root, its major version suffix and the subpackage path.
+// The module root is made up of the first depth elements, or all elements if depth is 0, but ends early at a
+// /vN major version element anywhere in the path. If gopkg is set, a .vN suffix on the last element of the
+// module root is recognised as major version suffix as well.
+// For example "/mod/v2/sub" splits into "/mod", "/v2" and "/sub", and "/yaml.v3/sub" into "/yaml", ".v3" and "/sub".
+func splitModulePath(path string, depth int, gopkg bool) (root, major, rest string) {
+	if strings.Trim(path, "/") == "" {
+		return path, "", ""
+	}
+
+	elems := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	n := len(elems)
+	if depth > 0 && depth < n {
+		n = depth
+	}
+
+	// A major version element ends the module root. The first element is never a major version.
+	for i := 1; i < n; i++ {
+		if majorVersionRe.MatchString(elems[i]) {
+			n = i
+			break
+		}
+	}
+	rootElems, restElems := elems[:n], elems[n:]
+
+	if len(restElems) > 0 && majorVersionRe.MatchString(restElems[0]) {
+		major = "/" + restElems[0]
+		restElems = restElems[1:]
+	} else if gopkg {
+		if m := gopkgVersionRe.FindStringSubmatch(rootElems[n-1]); m != nil {
+			rootElems[n-1] = m[1]
+			major = m[2]
+		}
+	}
+
+	root = "/" + strings.Join(rootElems, "/")
+	if len(restElems) > 0 {
+		rest = "/" + strings.Join(restElems, "/")
+	}
+	return root, major, rest
 }
 
-// GetPackagePath extracts the host and path from the request URL,
+// keepMajorVersion reports whether the major version suffix belongs in the go-import prefix. gopkg.in-style
+// suffixes are part of the last path element and are always kept, /vN suffixes only for major version
+// subdirectory modules.
+func keepMajorVersion(major string, cfg *Config) bool {
+	return strings.HasPrefix(major, ".") || (major != "" && cfg.VersionedPrefix)
+}
+
+// explicitModuleRoot returns the module root of an import path below an explicitly configured module,
+// appending a /vN major version element following the module if it belongs in the prefix.
+func explicitModuleRoot(module, importPath string, cfg *Config) string {
+	rest := strings.TrimPrefix(importPath, module)
+	elem, _, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+	if majorVersionRe.MatchString(elem) && keepMajorVersion("/"+elem, cfg) {
+		return module + "/" + elem
+	}
+	return module
+}
+
+// GetPackagePath extracts the host and module root path from the request URL,
 // omitting the scheme. This is used for the go-import meta tag.
-func GetPackagePath(r string) (string, error) {
+func GetPackagePath(r string, cfg *Config) (string, error) {
 	// Parse the request URL
 	parsedURL, err := url.Parse(r)
 	if err != nil {
 		return "", err
 	}
 
-	// Remove any /vX suffix from the path
-	parsedURL.Path = removeVersionSuffix(parsedURL.Path)
+	// Explicitly mapped modules use the module path of their rule.
+	if rule := cfg.MatchRule(parsedURL.Host + parsedURL.Path); rule != nil {
+		return explicitModuleRoot(rule.Module, parsedURL.Host+parsedURL.Path, cfg), nil
+	}
+
+	// With regular expression rewrite rules, the module root is the part matched by the rule.
+	// The rules are matched against the import path without any /vX major version element.
+	if cfg.RewriteMode == RewriteModeRegexp {
+		root, major, rest := splitModulePath(parsedURL.Path, 0, false)
+		importPath := parsedURL.Host + root + rest
+		_, loc, err := matchRewriteRule(importPath, cfg)
+		if err != nil {
+			return "", err
+		}
+		if loc[1] == len(parsedURL.Host+root) && keepMajorVersion(major, cfg) {
+			return importPath[:loc[1]] + major, nil
+		}
+		return importPath[:loc[1]], nil
+	}
+
+	// Listed modules are their own module root, even if deeper than PathDepth.
+	if module := cfg.MatchModule(parsedURL.Host + parsedURL.Path); module != "" {
+		return explicitModuleRoot(module, parsedURL.Host+parsedURL.Path, cfg), nil
+	}
+
+	// Reduce subpackage paths to the module root, keeping the major version suffix if it belongs in the prefix.
+	root, major, _ := splitModulePath(parsedURL.Path, cfg.PathDepth, cfg.GopkgVersions)
+	if keepMajorVersion(major, cfg) {
+		root += major
+	}
 
 	// Concatenate the host and path
-	packagePath := fmt.Sprintf("%s%s", parsedURL.Host, parsedURL.Path)
+	packagePath := fmt.Sprintf("%s%s", parsedURL.Host, root)
 	return packagePath, nil
 }
 
-// RewriteURL rewrites a given URL based on the provided patterns and replacements configuration.
+// RewriteURL rewrites a given URL to the repository URL of its module, using the matching rule if any,
+// else the provided patterns and replacements configuration.
 func RewriteURL(originalURL string, cfg *Config) (string, error) {
 	copy, err := url.Parse(originalURL)
 	if err != nil {
 		return "", err
 	}
 
+	// Explicitly mapped modules use the repository of their rule.
+	if rule := cfg.MatchRule(copy.Host + copy.Path); rule != nil {
+		return rule.Repository, nil
+	}
+
+	// Reduce subpackage paths to the module root without major version suffix, so they map onto the repository root.
+	// Listed modules are their own module root, even if deeper than PathDepth.
+	if module := cfg.MatchModule(copy.Host + copy.Path); module != "" {
+		copy.Path, _, _ = splitModulePath(strings.TrimPrefix(module, copy.Host), 0, cfg.GopkgVersions)
+	} else {
+		copy.Path, _, _ = splitModulePath(copy.Path, cfg.PathDepth, cfg.GopkgVersions)
+	}
+
 	// Replace parts of the URL according to the specified patterns and replacements.
 	copy.Scheme = strings.Replace(copy.Scheme, cfg.SchemePattern, cfg.SchemeReplacement, 1)
 	copy.Host = strings.Replace(copy.Host, cfg.HostPattern, cfg.HostReplacement, 1)
 	copy.Path = strings.Replace(copy.Path, cfg.PathPattern, cfg.PathReplacement, 1)
 
-	// Remove any /vX suffix from the path
-	copy.Path = removeVersionSuffix(copy.Path)
-
 	// Remove ?go-get=1 from the go get request
 	query := copy.Query()
 	query.Del("go-get")
@@ -68,3 +172,48 @@ func RewriteURL(originalURL string, cfg *Config) (string, error) {
 
 	return copy.String(), nil // Return the modified URL as a string.
 }
+
+// matchRewriteRule finds the first rewrite rule whose pattern matches the import path.
+// It returns the rule along with the submatch indices of the match.
+func matchRewriteRule(importPath string, cfg *Config) (*RewriteRule, []int, error) {
+	for i := range cfg.RewriteRules {
+		rule := &cfg.RewriteRules[i]
+		re, err := rule.regexp()
+		if err != nil {
+			return nil, nil, err
+		}
+		if loc := re.FindStringSubmatchIndex(importPath); loc != nil {
+			return rule, loc, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: %s", ErrNoRewriteRule, importPath)
+}
+
+// RewriteURLRegexp rewrites a given URL to the repository URL of its module, using the matching rule if any,
+// else the first regular expression rewrite rule matching the import path. The replacement template of that
+// rule is expanded with the capture groups of the match, e.g. $1 or ${name}.
+func RewriteURLRegexp(originalURL string, cfg *Config) (string, error) {
+	parsedURL, err := url.Parse(originalURL)
+	if err != nil {
+		return "", err
+	}
+
+	// Explicitly mapped modules use the repository of their rule.
+	if rule := cfg.MatchRule(parsedURL.Host + parsedURL.Path); rule != nil {
+		return rule.Repository, nil
+	}
+
+	// Match the import path, without any /vX major version element, against the rewrite rules in order.
+	root, _, rest := splitModulePath(parsedURL.Path, 0, false)
+	importPath := parsedURL.Host + root + rest
+	rule, loc, err := matchRewriteRule(importPath, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	re, err := rule.regexp()
+	if err != nil {
+		return "", err
+	}
+	return string(re.ExpandString(nil, rule.Replace, importPath, loc)), nil
+}
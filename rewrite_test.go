@@ -16,6 +16,7 @@ type GetRequestURLTestCase struct {
 type GetPackagePathTestCase struct {
 	name         string
 	url          string
+	cfg          *Config
 	expectedPath string
 	expectError  bool
 }
@@ -55,16 +56,107 @@ var getPackagePathTestCases = []GetPackagePathTestCase{
 	{
 		name:         "Generic HTTP URL",
 		url:          "http://example.com/path",
+		cfg:          &Config{PathDepth: 1},
 		expectedPath: "example.com/path",
 	},
 	{
 		name:         "Remove /vX suffix",
 		url:          "https://example.com/path/v2",
+		cfg:          &Config{PathDepth: 1},
 		expectedPath: "example.com/path",
 	},
+	{
+		name:         "Remove /vX element followed by subpackage",
+		url:          "https://go.loafoe.dev/mod/v2/subpkg",
+		cfg:          &Config{PathDepth: 1},
+		expectedPath: "go.loafoe.dev/mod",
+	},
+	{
+		name:         "Remove /vX element within configured depth",
+		url:          "https://go.loafoe.dev/mod/v3/subpkg",
+		cfg:          &Config{PathDepth: 3},
+		expectedPath: "go.loafoe.dev/mod",
+	},
+	{
+		name:         "Keep /vX suffix for major version subdirectory modules",
+		url:          "https://go.loafoe.dev/mod/v2?go-get=1",
+		cfg:          &Config{PathDepth: 1, VersionedPrefix: true},
+		expectedPath: "go.loafoe.dev/mod/v2",
+	},
+	{
+		name:         "Keep /vX element followed by subpackage for major version subdirectory modules",
+		url:          "https://go.loafoe.dev/mod/v2/subpkg",
+		cfg:          &Config{PathDepth: 1, VersionedPrefix: true},
+		expectedPath: "go.loafoe.dev/mod/v2",
+	},
+	{
+		name:         "Keep /vX element for explicitly mapped major version subdirectory modules",
+		url:          "https://go.loafoe.dev/tools/mod/v2/subpkg",
+		cfg:          &Config{PathDepth: 1, VersionedPrefix: true, Rules: []Rule{{Module: "go.loafoe.dev/tools/mod", Repository: "https://gitlab.com/tools/mod"}}},
+		expectedPath: "go.loafoe.dev/tools/mod/v2",
+	},
+	{
+		name:         "Version element v1 is a subpackage",
+		url:          "https://go.loafoe.dev/api/v1",
+		cfg:          &Config{PathDepth: 0},
+		expectedPath: "go.loafoe.dev/api/v1",
+	},
+	{
+		name:         "Keep gopkg.in-style .vX suffix",
+		url:          "https://go.loafoe.dev/yaml.v3/subpkg",
+		cfg:          &Config{PathDepth: 1, GopkgVersions: true},
+		expectedPath: "go.loafoe.dev/yaml.v3",
+	},
+	{
+		name:         "Subpackage resolves to module root",
+		url:          "https://example.com/path/internal/foo?go-get=1",
+		cfg:          &Config{PathDepth: 1},
+		expectedPath: "example.com/path",
+	},
+	{
+		name:         "Subpackage resolves to module root at configured depth",
+		url:          "https://example.com/x/path/internal/foo",
+		cfg:          &Config{PathDepth: 2},
+		expectedPath: "example.com/x/path",
+	},
+	{
+		name: "Explicitly mapped module",
+		url:  "https://example.com/tools/legacy/cmd?go-get=1",
+		cfg: &Config{
+			PathDepth: 1,
+			Rules:     []Rule{{Module: "example.com/tools/legacy", Repository: "https://gitlab.com/other/legacy"}},
+		},
+		expectedPath: "example.com/tools/legacy",
+	},
+	{
+		name: "Regexp rewrite mode uses matched module root",
+		url:  "https://go.loafoe.dev/x/foo/internal/bar?go-get=1",
+		cfg: &Config{
+			PathDepth:    1,
+			RewriteMode:  RewriteModeRegexp,
+			RewriteRules: []RewriteRule{{Match: `^go\.loafoe\.dev/x/([^/]+)`, Replace: "https://gitlab.com/loafoe/${1}-go"}},
+		},
+		expectedPath: "go.loafoe.dev/x/foo",
+	},
+	{
+		name: "Regexp rewrite mode without matching rule",
+		url:  "https://go.loafoe.dev/y/foo",
+		cfg: &Config{
+			RewriteMode:  RewriteModeRegexp,
+			RewriteRules: []RewriteRule{{Match: `^go\.loafoe\.dev/x/([^/]+)`, Replace: "https://gitlab.com/loafoe/${1}-go"}},
+		},
+		expectError: true,
+	},
+	{
+		name:         "Zero depth keeps full path",
+		url:          "https://example.com/path/internal/foo",
+		cfg:          &Config{PathDepth: 0},
+		expectedPath: "example.com/path/internal/foo",
+	},
 	{
 		name:        "Malformed URL",
 		url:         "http://a b.com/", // Malformed URL
+		cfg:         &Config{PathDepth: 1},
 		expectError: true,
 	},
 }
@@ -109,6 +201,82 @@ var rewriteURLTestCases = []RewriteURLTestCase{
 		},
 		expectedRewrittenURL: "https://github.com/loafoe-dev/go-bitfield",
 	},
+	{
+		name:        "Remove /vX element followed by subpackage",
+		originalURL: "http://go.loafoe.dev/mod/v2/subpkg?go-get=1",
+		cfg: &Config{
+			SchemePattern:     "http",
+			SchemeReplacement: "https",
+			HostPattern:       "go.loafoe.dev",
+			HostReplacement:   "github.com",
+			PathPattern:       "/",
+			PathReplacement:   "/loafoe-dev/go-",
+			PathDepth:         1,
+			VersionedPrefix:   true,
+		},
+		expectedRewrittenURL: "https://github.com/loafoe-dev/go-mod",
+	},
+	{
+		name:        "Remove gopkg.in-style .vX suffix",
+		originalURL: "http://go.loafoe.dev/yaml.v3/subpkg?go-get=1",
+		cfg: &Config{
+			SchemePattern:     "http",
+			SchemeReplacement: "https",
+			HostPattern:       "go.loafoe.dev",
+			HostReplacement:   "github.com",
+			PathPattern:       "/",
+			PathReplacement:   "/loafoe-dev/go-",
+			PathDepth:         1,
+			GopkgVersions:     true,
+		},
+		expectedRewrittenURL: "https://github.com/loafoe-dev/go-yaml",
+	},
+	{
+		name:        "Keep .vX suffix without gopkg.in-style versions",
+		originalURL: "http://go.loafoe.dev/yaml.v3?go-get=1",
+		cfg: &Config{
+			SchemePattern:     "http",
+			SchemeReplacement: "https",
+			HostPattern:       "go.loafoe.dev",
+			HostReplacement:   "github.com",
+			PathPattern:       "/",
+			PathReplacement:   "/loafoe-dev/go-",
+			PathDepth:         1,
+		},
+		expectedRewrittenURL: "https://github.com/loafoe-dev/go-yaml.v3",
+	},
+	{
+		name:        "Subpackage rewrites to repository root",
+		originalURL: "http://go.loafoe.dev/modproxy/internal/foo?go-get=1",
+		cfg: &Config{
+			SchemePattern:     "http",
+			SchemeReplacement: "https",
+			HostPattern:       "go.loafoe.dev",
+			HostReplacement:   "github.com",
+			PathPattern:       "/",
+			PathReplacement:   "/loafoe-dev/go-",
+			PathDepth:         1,
+		},
+		expectedRewrittenURL: "https://github.com/loafoe-dev/go-modproxy",
+	},
+	{
+		name:        "Explicitly mapped module",
+		originalURL: "http://go.loafoe.dev/tools/legacy/cmd?go-get=1",
+		cfg: &Config{
+			SchemePattern:     "http",
+			SchemeReplacement: "https",
+			HostPattern:       "go.loafoe.dev",
+			HostReplacement:   "github.com",
+			PathPattern:       "/",
+			PathReplacement:   "/loafoe-dev/go-",
+			PathDepth:         1,
+			Rules: []Rule{
+				{Module: "go.loafoe.dev/tools", Repository: "https://github.com/loafoe-dev/tools"},
+				{Module: "go.loafoe.dev/tools/legacy", Repository: "https://gitlab.com/other/legacy"},
+			},
+		},
+		expectedRewrittenURL: "https://gitlab.com/other/legacy",
+	},
 	{
 		name:        "Malformed URL",
 		originalURL: "http://%42:8080/", // Malformed URL
@@ -124,6 +292,115 @@ var rewriteURLTestCases = []RewriteURLTestCase{
 	},
 }
 
+var rewriteURLRegexpTestCases = []RewriteURLTestCase{
+	{
+		name:        "Capture group replacement",
+		originalURL: "http://go.loafoe.dev/x/foo?go-get=1",
+		cfg: &Config{
+			RewriteRules: []RewriteRule{
+				{Match: `^go\.loafoe\.dev/x/([^/]+)`, Replace: "https://gitlab.com/loafoe/${1}-go"},
+			},
+		},
+		expectedRewrittenURL: "https://gitlab.com/loafoe/foo-go",
+	},
+	{
+		name:        "Subpackage and /vX suffix",
+		originalURL: "http://go.loafoe.dev/x/foo/internal/bar/v2?go-get=1",
+		cfg: &Config{
+			RewriteRules: []RewriteRule{
+				{Match: `^go\.loafoe\.dev/x/([^/]+)`, Replace: "https://gitlab.com/loafoe/${1}-go"},
+			},
+		},
+		expectedRewrittenURL: "https://gitlab.com/loafoe/foo-go",
+	},
+	{
+		name:        "Named capture group",
+		originalURL: "http://go.loafoe.dev/foo",
+		cfg: &Config{
+			RewriteRules: []RewriteRule{
+				{Match: `^go\.loafoe\.dev/(?P<name>[^/]+)`, Replace: "https://github.com/loafoe-dev/go-${name}"},
+			},
+		},
+		expectedRewrittenURL: "https://github.com/loafoe-dev/go-foo",
+	},
+	{
+		name:        "First matching rule wins",
+		originalURL: "http://go.loafoe.dev/x/foo",
+		cfg: &Config{
+			RewriteRules: []RewriteRule{
+				{Match: `^go\.loafoe\.dev/x/([^/]+)`, Replace: "https://gitlab.com/loafoe/${1}-go"},
+				{Match: `^go\.loafoe\.dev/([^/]+)`, Replace: "https://github.com/loafoe-dev/go-${1}"},
+			},
+		},
+		expectedRewrittenURL: "https://gitlab.com/loafoe/foo-go",
+	},
+	{
+		name:        "Explicitly mapped module",
+		originalURL: "http://go.loafoe.dev/x/foo",
+		cfg: &Config{
+			Rules: []Rule{{Module: "go.loafoe.dev/x/foo", Repository: "https://hg.example.org/foo"}},
+			RewriteRules: []RewriteRule{
+				{Match: `^go\.loafoe\.dev/x/([^/]+)`, Replace: "https://gitlab.com/loafoe/${1}-go"},
+			},
+		},
+		expectedRewrittenURL: "https://hg.example.org/foo",
+	},
+	{
+		name:        "No matching rule",
+		originalURL: "http://go.loafoe.dev/y/foo",
+		cfg: &Config{
+			RewriteRules: []RewriteRule{
+				{Match: `^go\.loafoe\.dev/x/([^/]+)`, Replace: "https://gitlab.com/loafoe/${1}-go"},
+			},
+		},
+		expectError: true,
+	},
+	{
+		name:        "Invalid pattern",
+		originalURL: "http://go.loafoe.dev/x/foo",
+		cfg: &Config{
+			RewriteRules: []RewriteRule{{Match: `^go\.loafoe\.dev/x/(`, Replace: "https://gitlab.com/loafoe/${1}-go"}},
+		},
+		expectError: true,
+	},
+}
+
+type SplitModulePathTestCase struct {
+	name          string
+	path          string
+	depth         int
+	gopkg         bool
+	expectedRoot  string
+	expectedMajor string
+	expectedRest  string
+}
+
+var splitModulePathTestCases = []SplitModulePathTestCase{
+	{name: "Empty path", path: "", depth: 1, expectedRoot: ""},
+	{name: "Root path", path: "/", depth: 1, expectedRoot: "/"},
+	{name: "Module root", path: "/mod", depth: 1, expectedRoot: "/mod"},
+	{name: "Subpackage", path: "/mod/sub/pkg", depth: 1, expectedRoot: "/mod", expectedRest: "/sub/pkg"},
+	{name: "Major version suffix", path: "/mod/v2", depth: 1, expectedRoot: "/mod", expectedMajor: "/v2"},
+	{name: "Major version element", path: "/mod/v2/sub", depth: 1, expectedRoot: "/mod", expectedMajor: "/v2", expectedRest: "/sub"},
+	{name: "Major version element within depth", path: "/x/mod/v10/sub", depth: 3, expectedRoot: "/x/mod", expectedMajor: "/v10", expectedRest: "/sub"},
+	{name: "Major version element with zero depth", path: "/x/mod/v2/sub", depth: 0, expectedRoot: "/x/mod", expectedMajor: "/v2", expectedRest: "/sub"},
+	{name: "First element is never a major version", path: "/v2/sub", depth: 0, expectedRoot: "/v2/sub"},
+	{name: "Not a major version", path: "/mod/v1/v02", depth: 0, expectedRoot: "/mod/v1/v02"},
+	{name: "gopkg.in-style suffix", path: "/yaml.v3/sub", depth: 1, gopkg: true, expectedRoot: "/yaml", expectedMajor: ".v3", expectedRest: "/sub"},
+	{name: "gopkg.in-style suffix disabled", path: "/yaml.v3/sub", depth: 1, expectedRoot: "/yaml.v3", expectedRest: "/sub"},
+}
+
+func TestSplitModulePath(t *testing.T) {
+	for _, tc := range splitModulePathTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, major, rest := splitModulePath(tc.path, tc.depth, tc.gopkg)
+			if root != tc.expectedRoot || major != tc.expectedMajor || rest != tc.expectedRest {
+				t.Errorf("splitModulePath(%q) = %q, %q, %q, want %q, %q, %q", tc.path, root, major, rest, tc.expectedRoot, tc.expectedMajor, tc.expectedRest)
+			}
+		})
+	}
+}
+
 func TestGetRequestURL(t *testing.T) {
 	for _, tc := range getRequestURLTestCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -138,7 +415,7 @@ func TestGetRequestURL(t *testing.T) {
 func TestGetPackagePath(t *testing.T) {
 	for _, tc := range getPackagePathTestCases {
 		t.Run(tc.name, func(t *testing.T) {
-			gotPath, err := GetPackagePath(tc.url)
+			gotPath, err := GetPackagePath(tc.url, tc.cfg)
 
 			// Check for error consistency
 			if (err != nil) != tc.expectError {
@@ -170,3 +447,40 @@ func TestRewriteURL(t *testing.T) {
 		})
 	}
 }
+
+func TestRewriteURLRegexp(t *testing.T) {
+	for _, tc := range rewriteURLRegexpTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rewrittenURL, err := RewriteURLRegexp(tc.originalURL, tc.cfg)
+
+			if (err != nil) != tc.expectError {
+				t.Errorf("RewriteURLRegexp() error = %v, expectError %v", err, tc.expectError)
+				return
+			}
+
+			if !tc.expectError && rewrittenURL != tc.expectedRewrittenURL {
+				t.Errorf("RewriteURLRegexp() got %v, want %v", rewrittenURL, tc.expectedRewrittenURL)
+			}
+		})
+	}
+}
+
+func TestValidateCompilesRewriteRules(t *testing.T) {
+	cfg := &Config{
+		RewriteMode:  RewriteModeRegexp,
+		RewriteRules: []RewriteRule{{Match: `^go\.loafoe\.dev/x/([^/]+)`, Replace: "https://gitlab.com/loafoe/${1}-go"}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RewriteRules[0].re == nil {
+		t.Fatalf("Validate() did not compile the rewrite rule")
+	}
+
+	// Matching uses the compiled pattern rather than compiling Match again.
+	cfg.RewriteRules[0].Match = "("
+	rewrittenURL, err := RewriteURLRegexp("https://go.loafoe.dev/x/tool", cfg)
+	if err != nil || rewrittenURL != "https://gitlab.com/loafoe/tool-go" {
+		t.Errorf("RewriteURLRegexp() = %v, %v, want https://gitlab.com/loafoe/tool-go", rewrittenURL, err)
+	}
+}
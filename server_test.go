@@ -0,0 +1,51 @@
+package modproxy
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewServer(t *testing.T) {
+	handler := http.NotFoundHandler()
+	srv := NewServer("127.0.0.1:8080", handler)
+
+	if srv.Addr != "127.0.0.1:8080" {
+		t.Errorf("NewServer() got addr %q, want %q", srv.Addr, "127.0.0.1:8080")
+	}
+	if srv.ReadTimeout != DefaultReadTimeout || srv.WriteTimeout != DefaultWriteTimeout || srv.IdleTimeout != DefaultIdleTimeout {
+		t.Errorf("NewServer() got timeouts read=%v write=%v idle=%v, want read=%v write=%v idle=%v",
+			srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout, DefaultReadTimeout, DefaultWriteTimeout, DefaultIdleTimeout)
+	}
+}
+
+func TestServeShutsDownGracefully(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := NewServer("127.0.0.1:0", http.NotFoundHandler())
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Serve(ctx, srv)
+	}()
+
+	// Give the server a moment to start listening before cancelling.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("Serve() error = %v, want nil", err)
+		}
+	case <-time.After(DefaultShutdownTimeout):
+		t.Fatalf("Serve() did not return after the context was cancelled")
+	}
+}
+
+func TestServeListenError(t *testing.T) {
+	srv := NewServer("127.0.0.1:-1", http.NotFoundHandler())
+	if err := Serve(context.Background(), srv); err == nil {
+		t.Errorf("Serve() with invalid address did not return an error")
+	}
+}
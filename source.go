@@ -0,0 +1,58 @@
+package modproxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Forge types supported for go-source meta tags. ForgeNone disables the go-source tag.
+const (
+	ForgeNone      = "none"
+	ForgeGitHub    = "github"
+	ForgeGitLab    = "gitlab"
+	ForgeGitea     = "gitea"
+	ForgeBitbucket = "bitbucket"
+)
+
+// sourceTemplate holds the directory and file URL templates of a forge.
+// {repo} and {ref} are expanded by modproxy, {/dir}, {file} and {line} are left for the consuming tool.
+type sourceTemplate struct {
+	directory string
+	file      string
+}
+
+var sourceTemplates = map[string]sourceTemplate{
+	ForgeGitHub: {
+		directory: "{repo}/tree/{ref}{/dir}",
+		file:      "{repo}/blob/{ref}{/dir}/{file}#L{line}",
+	},
+	ForgeGitLab: {
+		directory: "{repo}/-/tree/{ref}{/dir}",
+		file:      "{repo}/-/blob/{ref}{/dir}/{file}#L{line}",
+	},
+	ForgeGitea: {
+		directory: "{repo}/src/branch/{ref}{/dir}",
+		file:      "{repo}/src/branch/{ref}{/dir}/{file}#L{line}",
+	},
+	ForgeBitbucket: {
+		directory: "{repo}/src/{ref}{/dir}",
+		file:      "{repo}/src/{ref}{/dir}/{file}#lines-{line}",
+	},
+}
+
+// GetGoSource builds the content of the go-source meta tag from the package path and the rewritten repository URL.
+// Returns an empty string if no forge is configured.
+func GetGoSource(packagePath, repoURL string, cfg *Config) (string, error) {
+	forge := cfg.GetSourceForge(packagePath)
+	if forge == "" || forge == ForgeNone {
+		return "", nil
+	}
+
+	tmpl, ok := sourceTemplates[forge]
+	if !ok {
+		return "", fmt.Errorf("unsupported source forge %q", forge)
+	}
+
+	r := strings.NewReplacer("{repo}", repoURL, "{ref}", cfg.SourceRef)
+	return fmt.Sprintf("%s %s %s %s", packagePath, repoURL, r.Replace(tmpl.directory), r.Replace(tmpl.file)), nil
+}
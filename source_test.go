@@ -0,0 +1,67 @@
+package modproxy
+
+import "testing"
+
+// Test case struct
+type GetGoSourceTestCase struct {
+	name           string
+	cfg            *Config
+	expectedSource string
+	expectError    bool
+}
+
+// Test cases
+var getGoSourceTestCases = []GetGoSourceTestCase{
+	{
+		name:           "No forge configured",
+		cfg:            &Config{},
+		expectedSource: "",
+	},
+	{
+		name:           "Forge disabled",
+		cfg:            &Config{SourceForge: ForgeNone},
+		expectedSource: "",
+	},
+	{
+		name:           "GitHub",
+		cfg:            &Config{SourceForge: ForgeGitHub, SourceRef: "main"},
+		expectedSource: "go.loafoe.dev/modproxy https://example.com/go-modproxy https://example.com/go-modproxy/tree/main{/dir} https://example.com/go-modproxy/blob/main{/dir}/{file}#L{line}",
+	},
+	{
+		name:           "GitLab",
+		cfg:            &Config{SourceForge: ForgeGitLab, SourceRef: "main"},
+		expectedSource: "go.loafoe.dev/modproxy https://example.com/go-modproxy https://example.com/go-modproxy/-/tree/main{/dir} https://example.com/go-modproxy/-/blob/main{/dir}/{file}#L{line}",
+	},
+	{
+		name:           "Gitea",
+		cfg:            &Config{SourceForge: ForgeGitea, SourceRef: "main"},
+		expectedSource: "go.loafoe.dev/modproxy https://example.com/go-modproxy https://example.com/go-modproxy/src/branch/main{/dir} https://example.com/go-modproxy/src/branch/main{/dir}/{file}#L{line}",
+	},
+	{
+		name:           "Bitbucket",
+		cfg:            &Config{SourceForge: ForgeBitbucket, SourceRef: "master"},
+		expectedSource: "go.loafoe.dev/modproxy https://example.com/go-modproxy https://example.com/go-modproxy/src/master{/dir} https://example.com/go-modproxy/src/master{/dir}/{file}#lines-{line}",
+	},
+	{
+		name:        "Unsupported forge",
+		cfg:         &Config{SourceForge: "sourcehut"},
+		expectError: true,
+	},
+}
+
+func TestGetGoSource(t *testing.T) {
+	for _, tc := range getGoSourceTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			goSource, err := GetGoSource("go.loafoe.dev/modproxy", "https://example.com/go-modproxy", tc.cfg)
+
+			if (err != nil) != tc.expectError {
+				t.Errorf("GetGoSource() error = %v, expectError %v", err, tc.expectError)
+				return
+			}
+
+			if !tc.expectError && goSource != tc.expectedSource {
+				t.Errorf("GetGoSource() got %v, want %v", goSource, tc.expectedSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package modproxy
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+)
+
+// Names of the templates rendered by modproxy.
+const (
+	indexTemplate  = "index.html"
+	moduleTemplate = "module.html"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// defaultTemplates holds the built-in templates.
+var defaultTemplates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// LoadTemplates parses the *.html templates in TemplateDir, if set, on top of the built-in ones.
+// A template in the directory replaces the built-in template with the same file name.
+func (cfg *Config) LoadTemplates() error {
+	if cfg.TemplateDir == "" {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(cfg.TemplateDir, "*.html"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no templates in %s", cfg.TemplateDir)
+	}
+
+	// Parse the built-in templates afresh, as templates cannot be cloned once executed.
+	templates, err := template.ParseFS(templateFS, "templates/*.html")
+	if err != nil {
+		return err
+	}
+	if templates, err = templates.ParseFiles(files...); err != nil {
+		return err
+	}
+	cfg.templates = templates
+	return nil
+}
+
+// getTemplates returns the templates loaded from TemplateDir, or the built-in ones if none were loaded.
+func (cfg *Config) getTemplates() *template.Template {
+	if cfg.templates != nil {
+		return cfg.templates
+	}
+	return defaultTemplates
+}
+
+// executeTemplate renders a template to a buffer, so that failures can still be answered with an error status.
+func executeTemplate(cfg *Config, name string, data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := cfg.getTemplates().ExecuteTemplate(&buf, name, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderTemplate renders a template as HTML response.
+func renderTemplate(w http.ResponseWriter, cfg *Config, name string, data any) {
+	body, err := executeTemplate(cfg, name, data)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(body)
+}
@@ -0,0 +1,97 @@
+package modproxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace exporters.
+const (
+	TraceExporterNone   = "none"
+	TraceExporterOTLP   = "otlp"
+	TraceExporterStdout = "stdout"
+)
+
+// tracer creates the spans of modproxy. It uses the global tracer provider, which doesn't record
+// anything unless SetupTracing is called.
+var tracer = otel.Tracer("go.loafoe.dev/modproxy")
+
+// validateTraceExporter checks a trace exporter against the supported values. An empty value is allowed.
+func validateTraceExporter(exporter string) error {
+	switch exporter {
+	case "", TraceExporterNone, TraceExporterOTLP, TraceExporterStdout:
+		return nil
+	default:
+		return fmt.Errorf("unsupported trace exporter %q", exporter)
+	}
+}
+
+// SetupTracing installs a global tracer provider exporting spans with the configured trace exporter, and the
+// W3C trace context propagator. The OTLP exporter sends spans over HTTP and is configured with the standard
+// OTEL_EXPORTER_OTLP_* environment variables, the stdout exporter writes them to standard output.
+// The returned function flushes and stops the exporter. Without an exporter configured, nothing is installed.
+func SetupTracing(ctx context.Context, cfg *Config) (shutdown func(context.Context) error, err error) {
+	var exporter sdktrace.SpanExporter
+	switch cfg.TraceExporter {
+	case "", TraceExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case TraceExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case TraceExporterStdout:
+		exporter, err = stdouttrace.New()
+	default:
+		err = validateTraceExporter(cfg.TraceExporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// endSpan records err, if any, on a span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// NewTracingHandler wraps a handler so that every request is served within a server span, continuing the
+// trace of the W3C trace context headers of the request, if any.
+func NewTracingHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("server.address", r.Host),
+				attribute.String("url.path", r.URL.Path),
+			))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		status := rec.statusCode()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package modproxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	cfg := &Config{
+		HostPattern:     "go.loafoe.dev",
+		HostReplacement: "github.com",
+		PathPattern:     "/",
+		PathReplacement: "/loafoe-dev/go-",
+		PathDepth:       1,
+	}
+	req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/modproxy/cmd?go-get=1", nil)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	NewHandler(cfg).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+		if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("span %s has trace ID %s, want that of the traceparent header", span.Name(), got)
+		}
+	}
+
+	server, ok := spans[http.MethodGet]
+	if !ok {
+		t.Fatalf("no server span, got %v", spans)
+	}
+	if got := server.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("server span has parent %s, want the span of the traceparent header", got)
+	}
+	modProxy, ok := spans["ModProxy"]
+	if !ok {
+		t.Fatalf("no ModProxy span, got %v", spans)
+	}
+	if modProxy.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("ModProxy span is not a child of the server span")
+	}
+
+	for _, name := range []string{"RequestURLGetter.GetRequestURL", "PackagePathGetter.GetPackagePath", "URLRewriter.RewriteURL"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("no %s span", name)
+			continue
+		}
+		if span.Parent().SpanID() != modProxy.SpanContext().SpanID() {
+			t.Errorf("%s span is not a child of the ModProxy span", name)
+		}
+	}
+}
+
+func TestSetupTracingUnsupportedExporter(t *testing.T) {
+	if _, err := SetupTracing(context.Background(), &Config{TraceExporter: "jaeger"}); err == nil {
+		t.Errorf("SetupTracing() error = nil, want error for unsupported exporter")
+	}
+}
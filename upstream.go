@@ -0,0 +1,136 @@
+package modproxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// upstreamProxy is an entry of an upstream GOPROXY list.
+type upstreamProxy struct {
+	url string
+	// fallThroughOnError is set if the proxy is followed by "|", so that any error falls through
+	// to the next proxy rather than only 404 Not Found and 410 Gone.
+	fallThroughOnError bool
+}
+
+// parseUpstream parses a GOPROXY-style list of proxy URLs separated by "," or "|".
+// The go command's "direct" and "off" keywords are rejected, as they cannot be served by a proxy.
+func parseUpstream(list string) ([]upstreamProxy, error) {
+	var proxies []upstreamProxy
+	for list != "" {
+		entry, sep := list, byte(0)
+		if i := strings.IndexAny(list, ",|"); i >= 0 {
+			entry, sep, list = list[:i], list[i], list[i+1:]
+		} else {
+			list = ""
+		}
+
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == "direct" || entry == "off" {
+			return nil, fmt.Errorf("upstream %q is not supported", entry)
+		}
+		u, err := url.Parse(entry)
+		if err != nil {
+			return nil, fmt.Errorf("upstream: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("upstream %q must be an http or https URL", entry)
+		}
+
+		proxies = append(proxies, upstreamProxy{url: strings.TrimSuffix(entry, "/"), fallThroughOnError: sep == '|'})
+	}
+	return proxies, nil
+}
+
+// upstreamHeaders are the response headers passed on from an upstream proxy.
+var upstreamHeaders = []string{"Content-Type", "Content-Length", "Cache-Control", "ETag", "Last-Modified"}
+
+// UpstreamProxy forwards GOPROXY protocol requests to a list of upstream proxies, trying them in order
+// like the go command does: a proxy followed by "," falls through to the next one only if it answers
+// 404 Not Found or 410 Gone, a proxy followed by "|" on any error.
+type UpstreamProxy struct {
+	Client *http.Client
+
+	proxies []upstreamProxy
+}
+
+// NewUpstreamProxy creates a new UpstreamProxy for a GOPROXY-style list of proxy URLs.
+func NewUpstreamProxy(list string) (*UpstreamProxy, error) {
+	proxies, err := parseUpstream(list)
+	if err != nil {
+		return nil, err
+	}
+	if len(proxies) == 0 {
+		return nil, fmt.Errorf("upstream: no proxies in %q", list)
+	}
+	return &UpstreamProxy{Client: http.DefaultClient, proxies: proxies}, nil
+}
+
+// fetch requests the path from an upstream proxy, passing on the trace context of the request.
+func (p *UpstreamProxy) fetch(r *http.Request, proxy upstreamProxy) (*http.Response, error) {
+	ctx, span := tracer.Start(r.Context(), "upstream "+r.Method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("url.full", proxy.url+r.URL.EscapedPath())))
+
+	req, err := http.NewRequestWithContext(ctx, r.Method, proxy.url+r.URL.EscapedPath(), nil)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := p.Client.Do(req)
+	if err == nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	}
+	endSpan(span, err)
+	return resp, err
+}
+
+// ServeHTTP forwards the request to the upstream proxies and streams back the first response
+// that does not fall through to the next proxy.
+func (p *UpstreamProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	for i, proxy := range p.proxies {
+		last := i == len(p.proxies)-1
+
+		resp, err := p.fetch(r, proxy)
+		if err != nil {
+			if proxy.fallThroughOnError && !last {
+				continue
+			}
+			http.Error(w, fmt.Sprintf("upstream %s: %v", proxy.url, err), http.StatusBadGateway)
+			return
+		}
+
+		notFound := resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone
+		if !last && resp.StatusCode != http.StatusOK && (notFound || proxy.fallThroughOnError) {
+			resp.Body.Close()
+			continue
+		}
+
+		for _, key := range upstreamHeaders {
+			if value := resp.Header.Get(key); value != "" {
+				w.Header().Set(key, value)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		resp.Body.Close()
+		return
+	}
+}
@@ -0,0 +1,182 @@
+package modproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Test case struct
+type ParseUpstreamTestCase struct {
+	name        string
+	list        string
+	expected    []upstreamProxy
+	expectError bool
+}
+
+// Test cases
+var parseUpstreamTestCases = []ParseUpstreamTestCase{
+	{
+		name:     "Single proxy",
+		list:     "https://proxy.golang.org/",
+		expected: []upstreamProxy{{url: "https://proxy.golang.org"}},
+	},
+	{
+		name: "Fall through on not found",
+		list: "https://proxy.example.org,https://proxy.golang.org",
+		expected: []upstreamProxy{
+			{url: "https://proxy.example.org"},
+			{url: "https://proxy.golang.org"},
+		},
+	},
+	{
+		name: "Fall through on any error",
+		list: "https://proxy.example.org|https://proxy.golang.org",
+		expected: []upstreamProxy{
+			{url: "https://proxy.example.org", fallThroughOnError: true},
+			{url: "https://proxy.golang.org"},
+		},
+	},
+	{
+		name:     "Empty list",
+		list:     "",
+		expected: nil,
+	},
+	{
+		name:        "Direct",
+		list:        "https://proxy.golang.org,direct",
+		expectError: true,
+	},
+	{
+		name:        "Not an HTTP URL",
+		list:        "file:///srv/goproxy",
+		expectError: true,
+	},
+}
+
+func TestParseUpstream(t *testing.T) {
+	for _, tc := range parseUpstreamTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			proxies, err := parseUpstream(tc.list)
+			if (err != nil) != tc.expectError {
+				t.Fatalf("parseUpstream() error = %v, expectError %v", err, tc.expectError)
+			}
+			if !tc.expectError && !reflect.DeepEqual(proxies, tc.expected) {
+				t.Errorf("parseUpstream() = %+v, want %+v", proxies, tc.expected)
+			}
+		})
+	}
+}
+
+// newTestUpstream starts a server answering every request with the given status code and its own name.
+func newTestUpstream(t *testing.T, name string, code int) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(code)
+		w.Write([]byte(name + " " + r.URL.Path))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestUpstreamProxy(t *testing.T) {
+	ok := newTestUpstream(t, "ok", http.StatusOK)
+	notFound := newTestUpstream(t, "notfound", http.StatusNotFound)
+	failing := newTestUpstream(t, "failing", http.StatusInternalServerError)
+	unreachable := "http://127.0.0.1:1"
+
+	testCases := []struct {
+		name         string
+		list         string
+		expectedCode int
+		expectedBody string
+	}{
+		{"First proxy answers", ok + "," + notFound, http.StatusOK, "ok /github.com/!azure/sdk/@v/list"},
+		{"Not found falls through", notFound + "," + ok, http.StatusOK, "ok /github.com/!azure/sdk/@v/list"},
+		{"Error stops with comma", failing + "," + ok, http.StatusInternalServerError, "failing /github.com/!azure/sdk/@v/list"},
+		{"Error falls through with pipe", failing + "|" + ok, http.StatusOK, "ok /github.com/!azure/sdk/@v/list"},
+		{"Unreachable falls through with pipe", unreachable + "|" + ok, http.StatusOK, "ok /github.com/!azure/sdk/@v/list"},
+		{"Unreachable stops with comma", unreachable + "," + ok, http.StatusBadGateway, ""},
+		{"Last proxy not found", notFound, http.StatusNotFound, "notfound /github.com/!azure/sdk/@v/list"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			proxy, err := NewUpstreamProxy(tc.list)
+			if err != nil {
+				t.Fatalf("NewUpstreamProxy() error = %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/github.com/!azure/sdk/@v/list", nil)
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedCode {
+				t.Errorf("UpstreamProxy got code %v, want %v", w.Code, tc.expectedCode)
+			}
+			if tc.expectedBody != "" && w.Body.String() != tc.expectedBody {
+				t.Errorf("UpstreamProxy got body %q, want %q", w.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestNewHandlerUpstream(t *testing.T) {
+	cfg := &Config{
+		HostPattern:     "go.loafoe.dev",
+		HostReplacement: "github.com",
+		PathPattern:     "/",
+		PathReplacement: "/loafoe-dev/go-",
+		PathDepth:       1,
+		Upstream:        newTestUpstream(t, "upstream", http.StatusOK),
+	}
+	handler := NewHandler(cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/golang.org/x/mod/@v/list", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "upstream /golang.org/x/mod/@v/list" {
+		t.Errorf("NewHandler() got code %v and body %q for other module", w.Code, w.Body.String())
+	}
+
+	// Modules of the vanity host are never forwarded, and answered with 404 if modules aren't served.
+	req = httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/go.loafoe.dev/modproxy/@v/list", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("NewHandler() got code %v and body %q for vanity module, want %v", w.Code, w.Body.String(), http.StatusNotFound)
+	}
+
+	// Nor are they if modules are served.
+	cfg.ServeModules = true
+	cfg.CacheDir = t.TempDir()
+	cfg.Rules = []Rule{{Module: "go.loafoe.dev/modproxy", Repository: "file://" + filepath.Join(t.TempDir(), "missing")}}
+	req = httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev/go.loafoe.dev/modproxy/@v/list", nil)
+	w = httptest.NewRecorder()
+	NewHandler(cfg).ServeHTTP(w, req)
+	if w.Body.String() == "upstream /go.loafoe.dev/modproxy/@v/list" {
+		t.Errorf("NewHandler() forwarded vanity module to upstream")
+	}
+}
+
+func TestNewHandlerWithoutServeModules(t *testing.T) {
+	cfg := &Config{
+		HostPattern:     "go.loafoe.dev",
+		HostReplacement: "github.com",
+		PathPattern:     "/",
+		PathReplacement: "/loafoe-dev/go-",
+		PathDepth:       1,
+	}
+
+	// The go command only falls back to the next proxy in GOPROXY on 404 and 410.
+	for _, path := range []string{"/go.loafoe.dev/foo/@v/list", "/go.loafoe.dev/foo/@latest", "/golang.org/x/mod/@v/v0.1.0.info"} {
+		req := httptest.NewRequest(http.MethodGet, "https://go.loafoe.dev"+path, nil)
+		w := httptest.NewRecorder()
+		NewHandler(cfg).ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("NewHandler() got code %v for %s, want %v: %s", w.Code, path, http.StatusNotFound, w.Body.String())
+		}
+	}
+}